@@ -0,0 +1,151 @@
+package kawa
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type handlerAckKey struct{}
+
+// handlerAck is the acknowledgement state of the message being handled, which
+// the processor passes to the handler through the context.  The message is
+// acknowledged once the processor is done with it and every hold taken on it
+// with HoldAck has been released.
+type handlerAck struct {
+	mu    sync.Mutex
+	ack   func()
+	holds int
+	// pending counts the processor's share of the ack and the unreleased
+	// holds.
+	pending  int
+	onAck    []func()
+	onFail   []func()
+	failOnce sync.Once
+}
+
+func withHandlerAck(ctx context.Context, ack func()) (context.Context, *handlerAck) {
+	ha := &handlerAck{ack: ack, pending: 1}
+	return context.WithValue(ctx, handlerAckKey{}, ha), ha
+}
+
+// release releases one share of the ack, and calls the message's ack once
+// none remain.
+func (ha *handlerAck) release() {
+	ha.mu.Lock()
+	ha.pending--
+	done := ha.pending == 0
+	ha.mu.Unlock()
+	if done {
+		Ack(ha.ack)
+	}
+}
+
+// final returns the ack func the processor should use for the message once
+// the handler has returned.  It releases the processor's share of the
+// message's ack, followed by calling any funcs registered with OnAck.
+func (ha *handlerAck) final() func() {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	if ha.holds == 0 && len(ha.onAck) == 0 {
+		return ha.ack
+	}
+	onAck := ha.onAck
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ha.release()
+			for _, fn := range onAck {
+				fn()
+			}
+		})
+	}
+}
+
+// fail calls the funcs registered with OnFailure, the first time it's called.
+func (ha *handlerAck) fail() {
+	ha.failOnce.Do(func() {
+		ha.mu.Lock()
+		onFail := ha.onFail
+		ha.mu.Unlock()
+		for _, fn := range onFail {
+			fn()
+		}
+	})
+}
+
+func (ha *handlerAck) isHeld() bool {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	return ha.holds > 0
+}
+
+// HoldAck holds back the acknowledgement of the message currently being
+// handled until the returned func is called, e.g. once a copy of the message
+// sent to another destination has been acknowledged, or once the message has
+// been aggregated with later messages and the result delivered.  The message
+// is acknowledged once the processor is done with it and every hold has been
+// released, so a handler which is called several times for one message, e.g.
+// after FlatMap in Compose, takes a hold on each call.
+//
+// HoldAck must be called before the handler returns.  Calling the returned
+// func more than once has no further effect.  Returns nil if ctx wasn't passed
+// to a Handler by a Processor.
+func HoldAck(ctx context.Context) func() {
+	ha, ok := ctx.Value(handlerAckKey{}).(*handlerAck)
+	if !ok {
+		return nil
+	}
+	ha.mu.Lock()
+	ha.holds++
+	ha.pending++
+	ha.mu.Unlock()
+	var once sync.Once
+	return func() { once.Do(ha.release) }
+}
+
+// OnAck registers fn to be called once the messages returned from the current
+// call to Handle have been acknowledged by the destination, or once the
+// handler returns if it doesn't return any messages.  Handlers use it together
+// with HoldAck to acknowledge earlier messages only after the output derived
+// from them has been delivered.  If ctx wasn't passed to a Handler by a
+// Processor, fn is called immediately.
+func OnAck(ctx context.Context, fn func()) {
+	ha, ok := ctx.Value(handlerAckKey{}).(*handlerAck)
+	if !ok {
+		fn()
+		return
+	}
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	ha.onAck = append(ha.onAck, fn)
+}
+
+// OnFailure registers fn to be called if the messages returned from the
+// current call to Handle fail to be delivered: sending them fails, the
+// destination nacks them, or handling fails with an error which stops the
+// processor.  Handlers use it to undo state recorded in anticipation of the
+// output being delivered.  fn is called at most once.  If ctx wasn't passed to
+// a Handler by a Processor, OnFailure does nothing.
+func OnFailure(ctx context.Context, fn func()) {
+	ha, ok := ctx.Value(handlerAckKey{}).(*handlerAck)
+	if !ok {
+		return
+	}
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	ha.onFail = append(ha.onFail, fn)
+}
+
+// AckAfter returns an ack func which calls ack once it has itself been
+// called n times, e.g. once each of n destinations a message was sent to has
+// acknowledged it.  A nil ack is ignored.
+func AckAfter(ack func(), n int) func() {
+	n = max(n, 1)
+	var calls atomic.Int64
+	return func() {
+		if calls.Add(1) == int64(n) {
+			Ack(ack)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAckAfter(t *testing.T) {
+	var called int
+	ack := kawa.AckAfter(func() { called++ }, 3)
+	ack()
+	ack()
+	assert.Zero(t, called, "ack should wait for the last call")
+	ack()
+	assert.Equal(t, 1, called, "ack should be called on the last call")
+	ack()
+	assert.Equal(t, 1, called, "ack should only be called once")
+
+	nilAck := kawa.AckAfter(nil, 2)
+	for i := 0; i < 2; i++ {
+		// shouldn't panic
+		nilAck()
+	}
+}
+
+func TestOnFailure(t *testing.T) {
+	var sent bool
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		if sent {
+			<-ctx.Done()
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+		sent = true
+		return kawa.Message[string]{Value: "hi"}, func() {}, nil
+	})
+	var acked, failed int
+	handler := kawa.HandlerFunc[string, string](func(ctx context.Context, msg kawa.Message[string]) ([]kawa.Message[string], error) {
+		kawa.OnAck(ctx, func() { acked++ })
+		kawa.OnFailure(ctx, func() { failed++ })
+		return []kawa.Message[string]{msg}, nil
+	})
+	errSend := errors.New("send failed")
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		return errSend
+	})
+	p, err := kawa.New(kawa.Config[string, string]{Source: src, Destination: dst, Handler: handler})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, p.Run(context.Background()), errSend)
+	assert.Zero(t, acked)
+	assert.Equal(t, 1, failed)
+}
@@ -0,0 +1,147 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig configures adaptive parallelism.  See Adaptive.
+type AdaptiveConfig struct {
+	// Min and Max bound the number of workers.
+	Min, Max int
+	// Interval is how often the number of workers is adjusted.  Defaults to
+	// 1 second.
+	Interval time.Duration
+	// LatencyTolerance is the factor by which the average send latency of an
+	// interval may exceed the baseline latency before the interval is
+	// considered congested.  The baseline follows the lowest interval average,
+	// and rises slowly towards higher averages, so that a lasting change in the
+	// destination's latency eventually becomes the new normal.  Defaults to 2.
+	LatencyTolerance float64
+	// MaxErrorRate is the fraction of sends which may fail in an interval
+	// before it's considered congested.  Defaults to 0.05.
+	MaxErrorRate float64
+	// Backoff is the factor the number of workers is multiplied by after a
+	// congested interval.  Defaults to 0.75.
+	Backoff float64
+}
+
+// Adaptive enables adaptive parallelism: rather than running a fixed number
+// of workers, the processor adjusts the number between cfg.Min and cfg.Max
+// based on the latency and error rate of sends to the destination, using an
+// additive-increase/multiplicative-decrease limiter.  The latency of a send is
+// measured from calling Send until the destination acknowledges the messages,
+// so that destinations which acknowledge asynchronously, such as x/batcher,
+// are accounted for.  After each interval in which messages were sent, the
+// number of workers is increased by one if sends were healthy, or multiplied
+// by cfg.Backoff if they were congested.
+//
+// The processor starts with the number of workers set by Parallelism, bounded
+// by cfg.Min and cfg.Max.  The current number is reported by Stats, and may
+// also be set by SetParallelism, from which the limiter continues adjusting.
+// Adaptive can't be combined with KeyOrdering.
+func Adaptive(cfg AdaptiveConfig) func(*Options) {
+	return func(o *Options) {
+		o.Adaptive = &cfg
+	}
+}
+
+func (ac *AdaptiveConfig) validate() error {
+	if ac.Min < 1 || ac.Max < ac.Min {
+		return errors.New("adaptive parallelism requires 1 <= Min <= Max")
+	}
+	if ac.Interval <= 0 {
+		ac.Interval = time.Second
+	}
+	if ac.LatencyTolerance <= 1 {
+		ac.LatencyTolerance = 2
+	}
+	if ac.MaxErrorRate <= 0 {
+		ac.MaxErrorRate = 0.05
+	}
+	if ac.Backoff <= 0 || ac.Backoff >= 1 {
+		ac.Backoff = 0.75
+	}
+	return nil
+}
+
+// baselineDecay is the fraction of the difference by which the baseline rises
+// towards an interval's average latency when the average is higher.
+const baselineDecay = 0.1
+
+// limiter observes sends to the destination and chooses the number of workers
+// after each interval.
+type limiter struct {
+	cfg AdaptiveConfig
+
+	mu       sync.Mutex
+	sends    int
+	failures int
+	latency  time.Duration
+	// baseline is the reference send latency, which follows the lowest
+	// average of an interval and decays towards higher ones.
+	baseline time.Duration
+}
+
+func newLimiter(cfg AdaptiveConfig) *limiter {
+	return &limiter{cfg: cfg}
+}
+
+// observe records a send which took d to be acknowledged, or failed if err is
+// set.
+func (l *limiter) observe(d time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sends++
+	l.latency += d
+	if err != nil {
+		l.failures++
+	}
+}
+
+// next returns the number of workers to run for the next interval given the
+// current number, based on the sends observed since it was last called.
+func (l *limiter) next(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sends, failures, latency := l.sends, l.failures, l.latency
+	l.sends, l.failures, l.latency = 0, 0, 0
+
+	if sends == 0 {
+		// Nothing to learn from an idle interval.
+		return l.clamp(n)
+	}
+	avg := latency / time.Duration(sends)
+	if l.baseline == 0 || avg < l.baseline {
+		l.baseline = avg
+	} else {
+		l.baseline += time.Duration(float64(avg-l.baseline) * baselineDecay)
+	}
+	congested := float64(failures)/float64(sends) > l.cfg.MaxErrorRate ||
+		float64(avg) > float64(l.baseline)*l.cfg.LatencyTolerance
+	if congested {
+		return l.clamp(int(math.Floor(float64(n) * l.cfg.Backoff)))
+	}
+	return l.clamp(n + 1)
+}
+
+func (l *limiter) clamp(n int) int {
+	return min(max(n, l.cfg.Min), l.cfg.Max)
+}
+
+// adapt adjusts the processor's parallelism every interval until ctx is done.
+func (p *Processor[T1, T2]) adapt(ctx context.Context) {
+	ticker := time.NewTicker(p.limiter.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.ctl.adjust(p.limiter.next)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package kawa_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorAdaptive(t *testing.T) {
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		return kawa.Message[string]{Value: "hi"}, func() {}, ctx.Err()
+	})
+	// The destination slows down sharply once more than 4 sends are
+	// concurrent.
+	var sending atomic.Int32
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		n := sending.Add(1)
+		defer sending.Add(-1)
+		if n > 4 {
+			time.Sleep(20 * time.Millisecond)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Adaptive(kawa.AdaptiveConfig{Min: 1, Max: 32, Interval: 25 * time.Millisecond}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Stats().Parallelism)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return p.Stats().Parallelism >= 4 }, 2*time.Second, time.Millisecond)
+	for i := 0; i < 40; i++ {
+		n := p.Stats().Parallelism
+		assert.GreaterOrEqual(t, n, 1)
+		assert.LessOrEqual(t, n, 7, "limit should back off when the destination is congested")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestProcessorAdaptiveAsyncAcks(t *testing.T) {
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case <-time.After(500 * time.Microsecond):
+			return kawa.Message[string]{Value: "hi"}, func() {}, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	// The destination returns from Send straight away and acknowledges
+	// later, like a batching destination, so only the time until the ack
+	// shows that it has slowed down.
+	var slow atomic.Bool
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		delay := time.Millisecond
+		if slow.Load() {
+			delay = 40 * time.Millisecond
+		}
+		time.AfterFunc(delay, ack)
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Adaptive(kawa.AdaptiveConfig{Min: 1, Max: 32, Interval: 20 * time.Millisecond}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return p.Stats().Parallelism >= 8 }, 2*time.Second, time.Millisecond)
+	slow.Store(true)
+	require.Eventually(t, func() bool { return p.Stats().Parallelism <= 4 }, 2*time.Second, time.Millisecond,
+		"limit should back off when acks slow down")
+	// The baseline adapts to the new latency, so the limit grows again.
+	require.Eventually(t, func() bool { return p.Stats().Parallelism >= 8 }, 2*time.Second, time.Millisecond,
+		"limit should recover once the slower latency is the norm")
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestAdaptiveConfig(t *testing.T) {
+	cfg := kawa.Config[string, string]{
+		Source:      kawa.SourceFunc[string](nil),
+		Destination: kawa.DestinationFunc[string](nil),
+		Handler:     kawa.Pipe[string](),
+	}
+	_, err := kawa.New(cfg, kawa.Adaptive(kawa.AdaptiveConfig{Min: 4, Max: 2}))
+	assert.Error(t, err)
+	_, err = kawa.New(cfg, kawa.Adaptive(kawa.AdaptiveConfig{Min: 1, Max: 2}), kawa.KeyOrdering(true))
+	assert.Error(t, err)
+
+	p, err := kawa.New(cfg, kawa.Adaptive(kawa.AdaptiveConfig{Min: 2, Max: 8}), kawa.Parallelism(16))
+	require.NoError(t, err)
+	assert.Equal(t, 8, p.Stats().Parallelism)
+}
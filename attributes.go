@@ -0,0 +1,55 @@
+package kawa
+
+import "reflect"
+
+// WithAttribute returns parent wrapped with an attribute associating value
+// with key, in the same way as context.WithValue.  key should be of an
+// unexported type defined by the package setting it, to avoid collisions.
+func WithAttribute(parent Attributes, key, value any) Attributes {
+	if key == nil {
+		panic("nil attribute key")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("attribute key is not comparable")
+	}
+	return valueAttributes{parent: parent, key: key, value: value}
+}
+
+type valueAttributes struct {
+	parent     Attributes
+	key, value any
+}
+
+func (va valueAttributes) Unwrap() Attributes {
+	return va.parent
+}
+
+// AttributeValue returns the value associated with key by the outermost
+// attribute set with WithAttribute in the attrs chain, or nil if there is
+// none.
+func AttributeValue(attrs Attributes, key any) any {
+	for attrs != nil {
+		if va, ok := attrs.(valueAttributes); ok && va.key == key {
+			return va.value
+		}
+		attrs = attrs.Unwrap()
+	}
+	return nil
+}
+
+// AttributesAs returns the outermost attributes of type A in the attrs chain,
+// e.g. the attributes set by a particular source:
+//
+//	if ma, ok := kawa.AttributesAs[mqtt.Attributes](msg.Attributes); ok {
+//		log.Println(ma.QoS)
+//	}
+func AttributesAs[A Attributes](attrs Attributes) (A, bool) {
+	for attrs != nil {
+		if a, ok := attrs.(A); ok {
+			return a, true
+		}
+		attrs = attrs.Unwrap()
+	}
+	var zero A
+	return zero, false
+}
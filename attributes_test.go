@@ -0,0 +1,32 @@
+package kawa_test
+
+import (
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+)
+
+type attrKey struct{}
+
+type sourceAttrs struct {
+	N int
+}
+
+func (sa sourceAttrs) Unwrap() kawa.Attributes { return nil }
+
+func TestAttributes(t *testing.T) {
+	var attrs kawa.Attributes = sourceAttrs{N: 1}
+	attrs = kawa.WithAttribute(attrs, attrKey{}, "outer")
+
+	assert.Equal(t, "outer", kawa.AttributeValue(attrs, attrKey{}))
+	assert.Nil(t, kawa.AttributeValue(attrs, "missing"))
+	assert.Nil(t, kawa.AttributeValue(nil, attrKey{}))
+
+	sa, ok := kawa.AttributesAs[sourceAttrs](attrs)
+	assert.True(t, ok)
+	assert.Equal(t, 1, sa.N)
+
+	_, ok = kawa.AttributesAs[kawa.TraceAttributes](attrs)
+	assert.False(t, ok)
+}
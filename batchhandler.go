@@ -0,0 +1,214 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchHandler defines a function which operates on a batch of events of type
+// T1 at once, e.g. to amortize the cost of lookups against an external service.
+// It returns a slice of results with one entry per input message, in the same
+// order as the inputs.  Each entry holds the events of type T2 produced from
+// the corresponding input.  An empty entry indicates that the input was
+// processed successfully and no output was necessary.
+//
+// The processor acknowledges each input message once all of the outputs
+// produced from it have been acknowledged by the destination.  If an error is
+// returned, every message in the batch is subject to the processor's
+// ErrorPolicy.
+type BatchHandler[T1, T2 any] interface {
+	HandleBatch(context.Context, []Message[T1]) ([][]Message[T2], error)
+}
+
+type BatchHandlerFunc[T1, T2 any] func(context.Context, []Message[T1]) ([][]Message[T2], error)
+
+func (bhf BatchHandlerFunc[T1, T2]) HandleBatch(ctx context.Context, msgs []Message[T1]) ([][]Message[T2], error) {
+	return bhf(ctx, msgs)
+}
+
+// handleBatches is the equivalent of handle for a BatchHandler.
+func (p *Processor[T1, T2]) handleBatches(ctx, wctx context.Context, w *worker, next recvFunc[T1]) error {
+	in := p.receiveAll(ctx, next)
+	defer func() {
+		// Unblock the receiver if returning before it's done.  Anything it
+		// still delivers is left unacknowledged for the source to redeliver.
+		go func() {
+			for range in {
+			}
+		}()
+	}()
+	for {
+		w.set(StageReceiving)
+		batch, err := p.collect(in)
+		// Process what was received even if receiving failed, so that no
+		// message is left behind when draining.
+		if len(batch) > 0 {
+			if err := p.processBatch(wctx, w, batch); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, errPartitionClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recvResult is the outcome of a call to a recvFunc.
+type recvResult[T any] struct {
+	r   received[T]
+	err error
+}
+
+// receiveAll calls next using ctx until it returns an error, delivering each
+// result on the returned channel, which is closed after the error.  Receiving
+// in its own goroutine lets collect stop waiting for a batch to fill up
+// without canceling a receive in progress.
+func (p *Processor[T1, T2]) receiveAll(ctx context.Context, next recvFunc[T1]) <-chan recvResult[T1] {
+	in := make(chan recvResult[T1])
+	go func() {
+		defer close(in)
+		for {
+			r, err := next(ctx)
+			in <- recvResult[T1]{r: r, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return in
+}
+
+// collect receives up to batchSize messages from in.  It blocks until the
+// first message is received, then waits up to batchLinger for the rest.
+func (p *Processor[T1, T2]) collect(in <-chan recvResult[T1]) ([]received[T1], error) {
+	res := <-in
+	if res.err != nil {
+		return nil, res.err
+	}
+	batch := []received[T1]{res.r}
+
+	linger := time.NewTimer(p.batchLinger)
+	defer linger.Stop()
+	for len(batch) < p.batchSize {
+		select {
+		case res := <-in:
+			if res.err != nil {
+				return batch, res.err
+			}
+			batch = append(batch, res.r)
+		case <-linger.C:
+			return batch, nil
+		}
+	}
+	return batch, nil
+}
+
+// processBatch handles a batch of messages and sends the results to the
+// destination.  Errors returned are fatal to the processor.
+func (p *Processor[T1, T2]) processBatch(ctx context.Context, w *worker, batch []received[T1]) (err error) {
+	pm := p.metrics
+
+	msgs := make([]Message[T1], len(batch))
+	links := make([]trace.Link, 0, 2*len(batch))
+	for i, r := range batch {
+		msgs[i] = r.msg
+		links = append(links, r.link)
+		if sc := SpanContextFromAttributes(r.msg.Attributes); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := p.tracer.Start(ctx, "kawa.processor.batch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("kawa.batch.size", len(batch))))
+	defer func() { endSpan(span, err) }()
+
+	w.set(StageHandling)
+	hctx, hdlSpan := p.tracer.Start(ctx, "kawa.processor.handler.handle_batch")
+	var results [][]Message[T2]
+	start := time.Now()
+	err = p.withRetry(hctx, func(c context.Context) error {
+		var err error
+		results, err = p.batchHandler.HandleBatch(c, msgs)
+		return err
+	})
+	if err == nil && len(results) != len(batch) {
+		err = fmt.Errorf("returned %d results for a batch of %d messages", len(results), len(batch))
+	}
+	pm.handleDuration.Record(ctx, time.Since(start).Seconds(), pm.attrs)
+	endSpan(hdlSpan, err)
+	if err != nil {
+		p.recordError(ctx, "handler", err)
+		for _, r := range batch {
+			perr := applyErrorPolicy(ctx, p.errorPolicy, p.deadLetter, "handler", r.msg, r.ack, err)
+			if perr != nil {
+				return fmt.Errorf("handler: %w", perr)
+			}
+		}
+		return nil
+	}
+	p.stats.handled.Add(uint64(len(batch)))
+	pm.handled.Add(ctx, int64(len(batch)), pm.attrs)
+
+	var out []Message[T2]
+	var acks []func()
+	var nacks []NackFunc
+	for i, r := range batch {
+		if len(results[i]) == 0 {
+			Ack(r.ack)
+			continue
+		}
+		out = append(out, results[i]...)
+		acks = append(acks, r.ack)
+		if r.nack != nil {
+			nacks = append(nacks, r.nack)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	ack := func() {
+		for _, a := range acks {
+			a()
+		}
+	}
+	// The batch can only be nacked if every message in it can be.
+	var nack NackFunc
+	if len(nacks) == len(acks) {
+		nack = func(reason error, requeueAfter time.Duration) {
+			for _, n := range nacks {
+				n(reason, requeueAfter)
+			}
+		}
+	}
+
+	w.set(StageSending)
+	sctx, sendSpan := p.tracer.Start(ctx, "kawa.processor.dst.send")
+	if sc := sendSpan.SpanContext(); sc.IsValid() {
+		for i := range out {
+			out[i].Attributes = WithSpanContext(out[i].Attributes, sc)
+		}
+	}
+	if nack != nil {
+		sctx = ContextWithNack(sctx, nack)
+	}
+	start = time.Now()
+	err = p.sendWithRetry(sctx, ack, out)
+	pm.sendDuration.Record(ctx, time.Since(start).Seconds(), pm.attrs)
+	endSpan(sendSpan, err)
+	if err != nil {
+		p.recordError(ctx, "destination", err)
+		return p.sendFailed(nack, err)
+	}
+	p.sendFailures.Store(0)
+	p.stats.recordSend(len(out))
+	pm.sent.Add(ctx, int64(len(out)), pm.attrs)
+	return nil
+}
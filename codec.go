@@ -0,0 +1,214 @@
+package kawa
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Codec encodes values of type T to bytes and decodes them back.
+type Codec[T any] interface {
+	Encode(T) ([]byte, error)
+	Decode([]byte) (T, error)
+}
+
+// Format is a serialization format which can encode values of any type, in
+// the style of encoding/json.  Formats are registered by name with
+// RegisterFormat, and used as a Codec for a particular type through CodecFor.
+type Format interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{
+		"json":   jsonFormat{},
+		"ndjson": ndjsonFormat{},
+		"gob":    gobFormat{},
+	}
+)
+
+// RegisterFormat makes a format available by name through CodecFor.  The
+// json, ndjson and gob formats are registered by default.  Registering a name
+// twice replaces the previous format.
+func RegisterFormat(name string, f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[name] = f
+}
+
+// CodecFor returns a Codec for T using the format registered under name.
+func CodecFor[T any](name string) (Codec[T], error) {
+	formatsMu.RLock()
+	f, ok := formats[name]
+	formatsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return FormatCodec[T](f), nil
+}
+
+// FormatCodec returns a Codec for T using f.
+func FormatCodec[T any](f Format) Codec[T] {
+	return formatCodec[T]{f: f}
+}
+
+type formatCodec[T any] struct {
+	f Format
+}
+
+func (fc formatCodec[T]) Encode(v T) ([]byte, error) {
+	return fc.f.Marshal(v)
+}
+
+func (fc formatCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := fc.f.Unmarshal(data, &v)
+	return v, err
+}
+
+// JSONCodec encodes values as JSON using encoding/json.
+func JSONCodec[T any]() Codec[T] {
+	return FormatCodec[T](jsonFormat{})
+}
+
+// NDJSONCodec encodes values as JSON which is safe to write as a line of
+// newline-delimited JSON: the output is always a single line, without a
+// trailing newline, and HTML characters aren't escaped.  Decoding accepts a
+// trailing newline.
+func NDJSONCodec[T any]() Codec[T] {
+	return FormatCodec[T](ndjsonFormat{})
+}
+
+// GobCodec encodes values using encoding/gob.  Each value is encoded as a
+// self-contained gob stream, including its type information.
+func GobCodec[T any]() Codec[T] {
+	return FormatCodec[T](gobFormat{})
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonFormat) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type ndjsonFormat struct{}
+
+func (ndjsonFormat) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode always compacts its output and terminates it with a newline.
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (ndjsonFormat) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobFormat struct{}
+
+func (gobFormat) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobFormat) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// SerializationDestination encodes messages with a Codec and sends them to a
+// destination of bytes, e.g. x/s3 or x/printer.  It's the counterpart of
+// DeserializationSource.
+type SerializationDestination[T any] struct {
+	dst         Destination[[]byte]
+	codec       Codec[T]
+	errorPolicy ErrorPolicy
+	deadLetter  Destination[T]
+}
+
+type SerOption[T any] func(*SerOpts[T])
+
+type SerOpts[T any] struct {
+	ErrorPolicy ErrorPolicy
+	DeadLetter  Destination[T]
+}
+
+// SerErrors sets the policy applied to messages which fail to encode.
+// deadLetter receives the original message when policy is DeadLetterOnError,
+// and may be nil otherwise.
+func SerErrors[T any](policy ErrorPolicy, deadLetter Destination[T]) SerOption[T] {
+	return func(o *SerOpts[T]) {
+		o.ErrorPolicy = policy
+		o.DeadLetter = deadLetter
+	}
+}
+
+// NewSerDestination returns a destination which encodes messages with codec
+// and sends them to dst.  It returns an error if the options are invalid.
+func NewSerDestination[T any](dst Destination[[]byte], codec Codec[T], opts ...SerOption[T]) (SerializationDestination[T], error) {
+	var cfg SerOpts[T]
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.ErrorPolicy == DeadLetterOnError && cfg.DeadLetter == nil {
+		return SerializationDestination[T]{}, errors.New("DeadLetter destination required for DeadLetterOnError policy")
+	}
+	return SerializationDestination[T]{
+		dst:         dst,
+		codec:       codec,
+		errorPolicy: cfg.ErrorPolicy,
+		deadLetter:  cfg.DeadLetter,
+	}, nil
+}
+
+// Send encodes the messages and sends them to the wrapped destination.
+// Messages which fail to encode are handled according to the configured
+// ErrorPolicy.  Unless the policy is FailOnError, the rest of the messages are
+// still sent, and ack is called once all of the messages have been either
+// sent, skipped or dead-lettered.
+func (sd SerializationDestination[T]) Send(ctx context.Context, ack func(), msgs ...Message[T]) error {
+	out := make([]Message[[]byte], 0, len(msgs))
+	var failed []Message[T]
+	var errs []error
+	for _, msg := range msgs {
+		bts, err := sd.codec.Encode(msg.Value)
+		if err != nil {
+			if sd.errorPolicy == FailOnError {
+				return fmt.Errorf("serialize: %w", err)
+			}
+			failed = append(failed, msg)
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, withValue(msg, bts))
+	}
+
+	parts := len(failed)
+	if len(out) > 0 {
+		parts++
+	}
+	if parts == 0 {
+		return nil
+	}
+	ack = AckAfter(ack, parts)
+	for i, msg := range failed {
+		if err := applyErrorPolicy(ctx, sd.errorPolicy, sd.deadLetter, "serialize", msg, ack, errs[i]); err != nil {
+			return err
+		}
+	}
+	if len(out) > 0 {
+		return sd.dst.Send(ctx, ack, out...)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package kawa_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecEvent struct {
+	Name string
+	HTML string
+}
+
+func TestCodecs(t *testing.T) {
+	in := codecEvent{Name: "multi\nline", HTML: "<b>"}
+	for _, name := range []string{"json", "ndjson", "gob"} {
+		t.Run(name, func(t *testing.T) {
+			c, err := kawa.CodecFor[codecEvent](name)
+			require.NoError(t, err)
+			bts, err := c.Encode(in)
+			require.NoError(t, err)
+			out, err := c.Decode(bts)
+			require.NoError(t, err)
+			assert.Equal(t, in, out)
+		})
+	}
+
+	bts, err := kawa.NDJSONCodec[codecEvent]().Encode(in)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Name":"multi\nline","HTML":"<b>"}`, string(bts))
+
+	_, err = kawa.CodecFor[codecEvent]("missing")
+	assert.Error(t, err)
+}
+
+func TestSerDestinationSkip(t *testing.T) {
+	var sent []string
+	dst := kawa.DestinationFunc[[]byte](func(ctx context.Context, ack func(), msgs ...kawa.Message[[]byte]) error {
+		for _, m := range msgs {
+			sent = append(sent, string(m.Value))
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+	sd, err := kawa.NewSerDestination[float64](dst, kawa.JSONCodec[float64](),
+		kawa.SerErrors[float64](kawa.SkipOnError, nil))
+	require.NoError(t, err)
+
+	var acked int
+	err = sd.Send(context.Background(), func() { acked++ },
+		kawa.Message[float64]{Value: 1},
+		kawa.Message[float64]{Value: math.NaN()},
+		kawa.Message[float64]{Value: 2},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, sent)
+	assert.Equal(t, 1, acked)
+
+	sd, err = kawa.NewSerDestination[float64](dst, kawa.JSONCodec[float64]())
+	require.NoError(t, err)
+	err = sd.Send(context.Background(), nil, kawa.Message[float64]{Value: math.Inf(1)})
+	var ute *json.UnsupportedValueError
+	assert.True(t, errors.As(err, &ute), "encode error should be returned under FailOnError")
+
+	_, err = kawa.NewSerDestination[float64](dst, kawa.JSONCodec[float64](),
+		kawa.SerErrors[float64](kawa.DeadLetterOnError, nil))
+	assert.Error(t, err, "DeadLetterOnError requires a dead letter destination")
+}
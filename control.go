@@ -0,0 +1,165 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pause stops the processor from receiving messages from its source until
+// Resume is called.  Messages already received continue to be handled, sent
+// and acknowledged.  Pausing a processor which isn't running makes it start
+// paused when Run is called.
+func (p *Processor[T1, T2]) Pause() {
+	p.ctl.pause()
+}
+
+// Resume resumes receiving messages after Pause.
+func (p *Processor[T1, T2]) Resume() {
+	p.ctl.resume()
+}
+
+// Paused reports whether the processor is paused.
+func (p *Processor[T1, T2]) Paused() bool {
+	return p.ctl.isPaused()
+}
+
+// SetParallelism changes the number of workers receiving and processing
+// messages.  If the processor is running, workers are started or retired to
+// match.  A retired worker stops receiving, but finishes handling and sending
+// the message it's working on first.
+//
+// The parallelism of a running processor can't be changed when KeyOrdering is
+// set, because messages are partitioned by key across a fixed set of workers.
+func (p *Processor[T1, T2]) SetParallelism(n int) error {
+	if n < 1 {
+		return errors.New("parallelism must be at least 1")
+	}
+	c := &p.ctl
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running && p.keyOrdering {
+		return errors.New("can't change the parallelism of a running processor with KeyOrdering")
+	}
+	c.resize(n)
+	return nil
+}
+
+// parallelism returns the number of workers the processor runs.  With the
+// Adaptive option, this is the current limit chosen by the controller.
+func (p *Processor[T1, T2]) parallelism() int {
+	p.ctl.mu.Lock()
+	defer p.ctl.mu.Unlock()
+	return p.ctl.parallelism
+}
+
+// control holds the runtime controls of a processor.
+type control struct {
+	mu sync.Mutex
+	// resumed is closed while the processor isn't paused.
+	resumed     chan struct{}
+	parallelism int
+
+	running bool
+	// start, if set, starts a worker and returns a func which retires it.
+	start   func() context.CancelFunc
+	workers []context.CancelFunc
+}
+
+func (c *control) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil || c.isResumed() {
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *control) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil && !c.isResumed() {
+		close(c.resumed)
+	}
+}
+
+func (c *control) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed != nil && !c.isResumed()
+}
+
+// isResumed must be called with c.mu held and c.resumed set.
+func (c *control) isResumed() bool {
+	select {
+	case <-c.resumed:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait blocks until the processor isn't paused or ctx is done.
+func (c *control) wait(ctx context.Context) error {
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resize sets the parallelism to n, starting or retiring workers to match if
+// the processor is running.  It must be called with c.mu held.
+func (c *control) resize(n int) {
+	c.parallelism = n
+	if !c.running || c.start == nil {
+		return
+	}
+	for len(c.workers) < n {
+		c.workers = append(c.workers, c.start())
+	}
+	for len(c.workers) > n {
+		last := len(c.workers) - 1
+		c.workers[last]()
+		c.workers = c.workers[:last]
+	}
+}
+
+// adjust sets the parallelism to the result of calling fn with the current
+// parallelism.
+func (c *control) adjust(fn func(int) int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resize(fn(c.parallelism))
+}
+
+// begin records that the processor is running and returns its parallelism.
+// If start is set, it's used to start that many workers, and to start and
+// retire workers when the parallelism is changed.
+func (c *control) begin(start func() context.CancelFunc) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = true
+	if start != nil {
+		c.start = start
+		for i := 0; i < c.parallelism; i++ {
+			c.workers = append(c.workers, start())
+		}
+	}
+	return c.parallelism
+}
+
+// stop records that the processor is no longer starting workers.
+func (c *control) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	c.start = nil
+	c.workers = nil
+}
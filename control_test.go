@@ -0,0 +1,97 @@
+package kawa_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorPauseAndParallelism(t *testing.T) {
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case <-time.After(100 * time.Microsecond):
+			return kawa.Message[string]{Value: "hi"}, func() {}, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		kawa.Ack(ack)
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Parallelism(2))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return p.Stats().Received > 10 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return len(p.Stats().Workers) == 2 }, time.Second, time.Millisecond)
+
+	p.Pause()
+	assert.True(t, p.Paused())
+	assert.Equal(t, kawa.StatePaused, p.Status().State)
+	// Let any receive in progress when pausing finish.
+	time.Sleep(10 * time.Millisecond)
+	received := p.Stats().Received
+	time.Sleep(20 * time.Millisecond)
+	s := p.Stats()
+	assert.Equal(t, received, s.Received, "paused processor should not receive")
+	assert.Equal(t, s.Received, s.Acked, "in-flight messages should be finished while paused")
+
+	p.Resume()
+	assert.False(t, p.Paused())
+	require.Eventually(t, func() bool { return p.Stats().Received > received }, time.Second, time.Millisecond)
+
+	require.NoError(t, p.SetParallelism(5))
+	require.Eventually(t, func() bool { return len(p.Stats().Workers) == 5 }, time.Second, time.Millisecond)
+	require.NoError(t, p.SetParallelism(1))
+	require.Eventually(t, func() bool { return len(p.Stats().Workers) == 1 }, time.Second, time.Millisecond)
+	assert.Error(t, p.SetParallelism(0))
+
+	received = p.Stats().Received
+	require.Eventually(t, func() bool { return p.Stats().Received > received }, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	s = p.Stats()
+	assert.Equal(t, s.Received, s.Acked)
+	assert.Empty(t, s.Errors)
+}
+
+func TestProcessorSetParallelismKeyOrdering(t *testing.T) {
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		<-ctx.Done()
+		return kawa.Message[string]{}, nil, ctx.Err()
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Parallelism(2), kawa.KeyOrdering(true))
+	require.NoError(t, err)
+
+	// Allowed before running.
+	require.NoError(t, p.SetParallelism(3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	require.Eventually(t, func() bool { return len(p.Stats().Workers) == 3 }, time.Second, time.Millisecond)
+	assert.Error(t, p.SetParallelism(4))
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,79 @@
+package kawa
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrorPolicy determines what happens to a message which fails to be
+// processed.  The zero value, FailOnError, preserves the default behavior of
+// treating the error as fatal.
+type ErrorPolicy int
+
+const (
+	// FailOnError returns the error, which is fatal to the processor or source.
+	FailOnError ErrorPolicy = iota
+	// SkipOnError acknowledges and drops the failed message and continues
+	// processing.
+	SkipOnError
+	// DeadLetterOnError sends the failed message to a dead-letter destination,
+	// then continues processing.  The message is acknowledged once the
+	// dead-letter destination acknowledges it.
+	DeadLetterOnError
+)
+
+func (ep ErrorPolicy) String() string {
+	switch ep {
+	case FailOnError:
+		return "fail"
+	case SkipOnError:
+		return "skip"
+	case DeadLetterOnError:
+		return "dead-letter"
+	}
+	return fmt.Sprintf("ErrorPolicy(%d)", int(ep))
+}
+
+// DeadLetterAttributes are attached to messages sent to a dead-letter
+// destination.  They record the error which caused the message to be dead
+// lettered and the stage it failed in, and wrap the original attributes of the
+// message.
+type DeadLetterAttributes struct {
+	Err     error
+	Stage   string
+	Wrapped Attributes
+}
+
+func (dla DeadLetterAttributes) Unwrap() Attributes {
+	return dla.Wrapped
+}
+
+// applyErrorPolicy handles err according to policy for the message which
+// caused it.  It returns nil if the error was absorbed by the policy, and err
+// otherwise.
+func applyErrorPolicy[T any](
+	ctx context.Context,
+	policy ErrorPolicy,
+	deadLetter Destination[T],
+	stage string,
+	msg Message[T],
+	ack func(),
+	err error,
+) error {
+	switch policy {
+	case SkipOnError:
+		Ack(ack)
+		return nil
+	case DeadLetterOnError:
+		msg.Attributes = DeadLetterAttributes{
+			Err:     err,
+			Stage:   stage,
+			Wrapped: msg.Attributes,
+		}
+		if dlErr := deadLetter.Send(ctx, ack, msg); dlErr != nil {
+			return fmt.Errorf("dead letter: %w (original error: %v)", dlErr, err)
+		}
+		return nil
+	}
+	return err
+}
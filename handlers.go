@@ -0,0 +1,97 @@
+package kawa
+
+import (
+	"context"
+	"fmt"
+)
+
+// withValue returns a message carrying v along with the metadata of msg.
+func withValue[T1, T2 any](msg Message[T1], v T2) Message[T2] {
+	return Message[T2]{
+		Key:        msg.Key,
+		Value:      v,
+		Topic:      msg.Topic,
+		ID:         msg.ID,
+		EventTime:  msg.EventTime,
+		IngestTime: msg.IngestTime,
+		Headers:    msg.Headers,
+		Attributes: msg.Attributes,
+	}
+}
+
+// Map returns a handler which converts the value of each message with fn,
+// keeping the message's metadata.
+func Map[T1, T2 any](fn func(T1) (T2, error)) Handler[T1, T2] {
+	return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) ([]Message[T2], error) {
+		v, err := fn(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		return []Message[T2]{withValue(msg, v)}, nil
+	})
+}
+
+// FlatMap returns a handler which converts the value of each message into
+// any number of values with fn, each sent as a message with the metadata of
+// the original.  Messages for which fn returns no values are dropped.
+func FlatMap[T1, T2 any](fn func(T1) ([]T2, error)) Handler[T1, T2] {
+	return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) ([]Message[T2], error) {
+		vs, err := fn(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]Message[T2], len(vs))
+		for i, v := range vs {
+			out[i] = withValue(msg, v)
+		}
+		return out, nil
+	})
+}
+
+// Filter returns a handler which passes through the messages for which keep
+// returns true, and drops the rest.  Dropped messages are acknowledged.
+func Filter[T any](keep func(Message[T]) bool) Handler[T, T] {
+	return HandlerFunc[T, T](func(ctx context.Context, msg Message[T]) ([]Message[T], error) {
+		if !keep(msg) {
+			return nil, nil
+		}
+		return []Message[T]{msg}, nil
+	})
+}
+
+// KeyBy returns a handler which sets the Key of each message to the result of
+// fn, e.g. to partition messages with the KeyOrdering option downstream.
+func KeyBy[T any](fn func(Message[T]) string) Handler[T, T] {
+	return HandlerFunc[T, T](func(ctx context.Context, msg Message[T]) ([]Message[T], error) {
+		msg.Key = fn(msg)
+		return []Message[T]{msg}, nil
+	})
+}
+
+// SetTopic returns a handler which sets the Topic of each message.  Note that
+// destinations generally don't use Topic to choose where to write messages,
+// but it can be used to route them with x/multi.Router.
+func SetTopic[T any](topic string) Handler[T, T] {
+	return HandlerFunc[T, T](func(ctx context.Context, msg Message[T]) ([]Message[T], error) {
+		msg.Topic = topic
+		return []Message[T]{msg}, nil
+	})
+}
+
+// Tee returns a handler which sends a copy of each message to side and passes
+// the message through.  When run by a Processor, the message is acknowledged
+// once both side and the processor's destination have acknowledged it.
+//
+// If sending to side fails, the error is returned and subject to the
+// processor's ErrorPolicy, and side's hold on the acknowledgement is released
+// so that skipping or dead-lettering the message acknowledges it.
+func Tee[T any](side Destination[T]) Handler[T, T] {
+	return HandlerFunc[T, T](func(ctx context.Context, msg Message[T]) ([]Message[T], error) {
+		release := HoldAck(ctx)
+		if err := side.Send(ctx, release, msg); err != nil {
+			Ack(release)
+			return nil, fmt.Errorf("tee: %w", err)
+		}
+		return []Message[T]{msg}, nil
+	})
+}
@@ -0,0 +1,150 @@
+package kawa_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers(t *testing.T) {
+	ctx := context.Background()
+	msg := kawa.Message[string]{Key: "k", Value: "1,2,x", ID: "id"}
+
+	split := kawa.FlatMap(func(s string) ([]string, error) { return strings.Split(s, ","), nil })
+	numbers := kawa.Compose(split, kawa.Filter(func(m kawa.Message[string]) bool { return m.Value != "x" }))
+	parsed := kawa.Compose(numbers, kawa.Map(strconv.Atoi))
+	keyed := kawa.Compose(parsed, kawa.KeyBy(func(m kawa.Message[int]) string { return strconv.Itoa(m.Value % 2) }))
+	h := kawa.Compose(keyed, kawa.SetTopic[int]("numbers"))
+
+	out, err := h.Handle(ctx, msg)
+	require.NoError(t, err)
+	require.Len(t, out, 2)
+	assert.Equal(t, 1, out[0].Value)
+	assert.Equal(t, "1", out[0].Key)
+	assert.Equal(t, "id", out[0].ID)
+	assert.Equal(t, "numbers", out[0].Topic)
+	assert.Equal(t, 2, out[1].Value)
+	assert.Equal(t, "0", out[1].Key)
+
+	_, err = kawa.Map(strconv.Atoi).Handle(ctx, kawa.Message[string]{Value: "x"})
+	assert.Error(t, err)
+}
+
+func TestTee(t *testing.T) {
+	acked := make(chan struct{})
+	var sent bool
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		if sent {
+			<-ctx.Done()
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+		sent = true
+		return kawa.Message[string]{Value: "hi"}, func() { close(acked) }, nil
+	})
+
+	sideAck := make(chan func(), 1)
+	side := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		sideAck <- ack
+		return nil
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		kawa.Ack(ack)
+		return nil
+	})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Tee(side),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	ack := <-sideAck
+	select {
+	case <-acked:
+		t.Fatal("message acked before the side destination acked it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ack()
+	select {
+	case <-acked:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for ack")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestTeeAfterFlatMap(t *testing.T) {
+	acked := make(chan struct{})
+	var sent bool
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		if sent {
+			<-ctx.Done()
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+		sent = true
+		return kawa.Message[string]{Value: "a b c"}, func() { close(acked) }, nil
+	})
+
+	sideAcks := make(chan func(), 3)
+	side := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		sideAcks <- ack
+		return nil
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		kawa.Ack(ack)
+		return nil
+	})
+
+	split := kawa.FlatMap(func(s string) ([]string, error) { return strings.Fields(s), nil })
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Compose(split, kawa.Tee[string](side)),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	var acks []func()
+	for len(acks) < 3 {
+		select {
+		case ack := <-sideAcks:
+			acks = append(acks, ack)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for side sends")
+		}
+	}
+	// Each copy sent to side holds back the ack until side acks it.
+	for _, ack := range acks {
+		require.NotNil(t, ack)
+		select {
+		case <-acked:
+			t.Fatal("message acked before the side destination acked every copy")
+		case <-time.After(20 * time.Millisecond):
+		}
+		ack()
+	}
+	select {
+	case <-acked:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for ack")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+}
@@ -0,0 +1,72 @@
+// Package requeue provides a queue of nacked messages awaiting redelivery by
+// the sources in x/.
+package requeue
+
+import (
+	"sync"
+	"time"
+)
+
+// Queue holds values to be redelivered.  Adding to a Queue never blocks, so
+// values nacked after the source has stopped receiving don't leave goroutines
+// behind.
+type Queue[T any] struct {
+	mu    sync.Mutex
+	items []T
+	ready chan struct{}
+}
+
+func New[T any]() *Queue[T] {
+	return &Queue[T]{ready: make(chan struct{}, 1)}
+}
+
+// After adds v to the queue once d has elapsed.
+func (q *Queue[T]) After(v T, d time.Duration) {
+	if d <= 0 {
+		q.push(v)
+		return
+	}
+	time.AfterFunc(d, func() { q.push(v) })
+}
+
+func (q *Queue[T]) push(v T) {
+	q.mu.Lock()
+	q.items = append(q.items, v)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *Queue[T]) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready returns a channel which is sent to when values may be waiting in the
+// queue, after which Pop should be called.  It returns nil for a nil Queue, so
+// that receiving from it blocks forever.
+func (q *Queue[T]) Ready() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.ready
+}
+
+// Pop removes and returns the value at the head of the queue, if any.
+func (q *Queue[T]) Pop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var zero T
+	if len(q.items) == 0 {
+		return zero, false
+	}
+	v := q.items[0]
+	q.items[0] = zero
+	q.items = q.items[1:]
+	if len(q.items) > 0 {
+		// Wake another receiver for the rest.
+		q.signal()
+	}
+	return v, true
+}
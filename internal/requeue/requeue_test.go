@@ -0,0 +1,37 @@
+package requeue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	q := New[int]()
+	_, ok := q.Pop()
+	assert.False(t, ok)
+
+	// Adding never blocks, even with nobody receiving.
+	for i := 0; i < 3; i++ {
+		q.After(i, 0)
+	}
+	q.After(3, 5*time.Millisecond)
+
+	var got []int
+	for len(got) < 4 {
+		select {
+		case <-q.Ready():
+			if v, ok := q.Pop(); ok {
+				got = append(got, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for requeued values")
+		}
+	}
+	require.Equal(t, []int{0, 1, 2, 3}, got)
+
+	var nilQ *Queue[int]
+	assert.Nil(t, nilQ.Ready())
+}
@@ -0,0 +1,60 @@
+package kawa
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Header returns the value of the header key, or "" if it isn't set.
+func (m Message[T]) Header(key string) string {
+	return m.Headers[key]
+}
+
+// SetHeader sets the header key to value, allocating the Headers map if
+// necessary.
+func (m *Message[T]) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
+// Envelope is the JSON representation of a message along with its metadata,
+// which destinations can write in place of the bare value (see
+// MarshalEnvelope).
+type Envelope struct {
+	ID         string            `json:"id,omitempty"`
+	Key        string            `json:"key,omitempty"`
+	Topic      string            `json:"topic,omitempty"`
+	EventTime  *time.Time        `json:"event_time,omitempty"`
+	IngestTime *time.Time        `json:"ingest_time,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Value is embedded as is if it's valid JSON, or as a JSON string
+	// otherwise.
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalEnvelope encodes msg and its metadata as a JSON Envelope.
+func MarshalEnvelope(msg Message[[]byte]) ([]byte, error) {
+	env := Envelope{
+		ID:      msg.ID,
+		Key:     msg.Key,
+		Topic:   msg.Topic,
+		Headers: msg.Headers,
+		Value:   msg.Value,
+	}
+	if !msg.EventTime.IsZero() {
+		env.EventTime = &msg.EventTime
+	}
+	if !msg.IngestTime.IsZero() {
+		env.IngestTime = &msg.IngestTime
+	}
+	if !json.Valid(msg.Value) {
+		v, err := json.Marshal(string(msg.Value))
+		if err != nil {
+			return nil, err
+		}
+		env.Value = v
+	}
+	return json.Marshal(env)
+}
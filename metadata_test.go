@@ -0,0 +1,37 @@
+package kawa_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalEnvelope(t *testing.T) {
+	msg := kawa.Message[[]byte]{
+		ID:        "abc",
+		Key:       "k",
+		Value:     []byte(`{"n":1}`),
+		EventTime: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	msg.SetHeader("source", "test")
+	assert.Equal(t, "test", msg.Header("source"))
+	assert.Equal(t, "", msg.Header("missing"))
+
+	bts, err := kawa.MarshalEnvelope(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": "abc",
+		"key": "k",
+		"event_time": "2023-01-02T03:04:05Z",
+		"headers": {"source": "test"},
+		"value": {"n": 1}
+	}`, string(bts))
+
+	msg.Value = []byte("plain text")
+	bts, err = kawa.MarshalEnvelope(msg)
+	require.NoError(t, err)
+	assert.Contains(t, string(bts), `"value":"plain text"`)
+}
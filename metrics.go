@@ -0,0 +1,95 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// processorMetrics holds the OpenTelemetry instruments recorded by a
+// Processor.  When metrics are disabled, the instruments are no-ops.
+type processorMetrics struct {
+	attrs metric.MeasurementOption
+
+	received metric.Int64Counter
+	handled  metric.Int64Counter
+	sent     metric.Int64Counter
+	acked    metric.Int64Counter
+	nacked   metric.Int64Counter
+	errors   metric.Int64Counter
+	inflight metric.Int64UpDownCounter
+
+	handleDuration metric.Float64Histogram
+	sendDuration   metric.Float64Histogram
+}
+
+// newProcessorMetrics returns the processor's instruments, using the global
+// MeterProvider if enabled.  Metrics are disabled if the instruments can't be
+// created, rather than failing the processor.
+func newProcessorMetrics(name string, enabled bool) *processorMetrics {
+	noopMeter := noop.NewMeterProvider().Meter("kawa/processor")
+	if !enabled {
+		pm, _ := processorInstruments(noopMeter, name)
+		return pm
+	}
+	pm, err := processorInstruments(otel.Meter("kawa/processor"), name)
+	if err != nil {
+		slog.Error("kawa: creating metrics, disabling", "processor", name, "error", err)
+		pm, _ = processorInstruments(noopMeter, name)
+	}
+	return pm
+}
+
+func processorInstruments(meter metric.Meter, name string) (*processorMetrics, error) {
+	pm := &processorMetrics{
+		attrs: metric.WithAttributes(attribute.String("processor", name)),
+	}
+	var err, e error
+	pm.received, e = meter.Int64Counter("kawa.processor.messages.received",
+		metric.WithDescription("Messages received from the source"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.handled, e = meter.Int64Counter("kawa.processor.messages.handled",
+		metric.WithDescription("Messages successfully processed by the handler"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.sent, e = meter.Int64Counter("kawa.processor.messages.sent",
+		metric.WithDescription("Messages returned from the handler and sent to the destination"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.acked, e = meter.Int64Counter("kawa.processor.messages.acked",
+		metric.WithDescription("Received messages which have been acknowledged"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.nacked, e = meter.Int64Counter("kawa.processor.messages.nacked",
+		metric.WithDescription("Received messages which have been negatively acknowledged for redelivery"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.errors, e = meter.Int64Counter("kawa.processor.errors",
+		metric.WithDescription("Errors encountered, by stage"),
+		metric.WithUnit("{error}"))
+	err = errors.Join(err, e)
+	pm.inflight, e = meter.Int64UpDownCounter("kawa.processor.messages.inflight",
+		metric.WithDescription("Messages received but not yet acknowledged"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	pm.handleDuration, e = meter.Float64Histogram("kawa.processor.handle.duration",
+		metric.WithDescription("Time spent in the handler per message"),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	pm.sendDuration, e = meter.Float64Histogram("kawa.processor.send.duration",
+		metric.WithDescription("Time spent sending to the destination per message"),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+
+	return pm, err
+}
+
+func (pm *processorMetrics) error(ctx context.Context, stage string) {
+	pm.errors.Add(ctx, 1, pm.attrs, metric.WithAttributes(attribute.String("stage", stage)))
+}
@@ -0,0 +1,125 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collect returns the metrics recorded by reader, keyed by instrument name.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	res := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			res[m.Name] = m.Data
+		}
+	}
+	return res
+}
+
+// sum returns the total of the data points of an int64 counter which have
+// all of attrs.
+func sum(t *testing.T, agg metricdata.Aggregation, attrs ...attribute.KeyValue) int64 {
+	s, ok := agg.(metricdata.Sum[int64])
+	require.True(t, ok, "expected an int64 sum, got %T", agg)
+	var total int64
+	for _, dp := range s.DataPoints {
+		if hasAttrs(dp.Attributes, attrs) {
+			total += dp.Value
+		}
+	}
+	return total
+}
+
+// count returns the number of measurements recorded by a float64 histogram.
+func count(t *testing.T, agg metricdata.Aggregation) uint64 {
+	h, ok := agg.(metricdata.Histogram[float64])
+	require.True(t, ok, "expected a float64 histogram, got %T", agg)
+	var n uint64
+	for _, dp := range h.DataPoints {
+		n += dp.Count
+	}
+	return n
+}
+
+func hasAttrs(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProcessorMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(prev)
+
+	values := []string{"a", "bad", "c"}
+	msgs := make(chan kawa.Message[string], len(values))
+	for _, v := range values {
+		msgs <- kawa.Message[string]{Value: v}
+	}
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case m := <-msgs:
+			return m, func() {}, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	handler := kawa.HandlerFunc[string, string](func(ctx context.Context, msg kawa.Message[string]) ([]kawa.Message[string], error) {
+		if msg.Value == "bad" {
+			return nil, errors.New("bad message")
+		}
+		return []kawa.Message[string]{msg}, nil
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		kawa.Ack(ack)
+		return nil
+	})
+
+	// Instruments of a processor with metrics disabled aren't recorded.
+	_, err := kawa.New(kawa.Config[string, string]{Source: src, Destination: dst, Handler: handler})
+	require.NoError(t, err)
+	assert.Empty(t, collect(t, reader))
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     handler,
+		ErrorPolicy: kawa.SkipOnError,
+	}, kawa.Name("metered"), kawa.Metrics(true))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	require.Eventually(t, func() bool { return p.Stats().Acked == 3 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	m := collect(t, reader)
+	name := attribute.String("processor", "metered")
+	assert.Equal(t, int64(3), sum(t, m["kawa.processor.messages.received"], name))
+	assert.Equal(t, int64(2), sum(t, m["kawa.processor.messages.handled"], name))
+	assert.Equal(t, int64(2), sum(t, m["kawa.processor.messages.sent"], name))
+	assert.Equal(t, int64(3), sum(t, m["kawa.processor.messages.acked"], name))
+	assert.Equal(t, int64(0), sum(t, m["kawa.processor.messages.inflight"], name))
+	assert.Equal(t, int64(1), sum(t, m["kawa.processor.errors"], name, attribute.String("stage", "handler")))
+	assert.Equal(t, uint64(3), count(t, m["kawa.processor.handle.duration"]))
+	assert.Equal(t, uint64(2), count(t, m["kawa.processor.send.duration"]))
+}
@@ -0,0 +1,140 @@
+package kawa
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps a Handler to add behavior around it, e.g. recovering from
+// panics or enforcing deadlines.
+type Middleware[T1, T2 any] func(Handler[T1, T2]) Handler[T1, T2]
+
+// Wrap applies the middlewares to h.  The first middleware is the outermost,
+// so it sees each message first and each result last.
+func Wrap[T1, T2 any](h Handler[T1, T2], mws ...Middleware[T1, T2]) Handler[T1, T2] {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// PanicError is returned by handlers wrapped with Recover when they panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", pe.Value)
+}
+
+// Recover converts panics in the wrapped handler into a *PanicError, so they
+// can be handled like any other error, e.g. by the processor's ErrorPolicy.
+func Recover[T1, T2 any]() Middleware[T1, T2] {
+	return func(next Handler[T1, T2]) Handler[T1, T2] {
+		return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) (out []Message[T2], err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					pe, ok := r.(*PanicError)
+					if !ok {
+						pe = &PanicError{Value: r, Stack: debug.Stack()}
+					}
+					out, err = nil, pe
+				}
+			}()
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// Timeout limits the time the wrapped handler may spend on each message.  The
+// handler's context is canceled after d, and if the handler hasn't returned by
+// then, Timeout returns the context's error immediately and discards whatever
+// the handler eventually returns.  Handlers which ignore their context will
+// keep running in the background after timing out.
+//
+// Panics in the wrapped handler are propagated to the caller, so Timeout can
+// be used inside of Recover.
+func Timeout[T1, T2 any](d time.Duration) Middleware[T1, T2] {
+	return func(next Handler[T1, T2]) Handler[T1, T2] {
+		return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) ([]Message[T2], error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type result struct {
+				out []Message[T2]
+				err error
+				pe  *PanicError
+			}
+			resc := make(chan result, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						resc <- result{pe: &PanicError{Value: r, Stack: debug.Stack()}}
+					}
+				}()
+				out, err := next.Handle(ctx, msg)
+				resc <- result{out: out, err: err}
+			}()
+
+			select {
+			case res := <-resc:
+				if res.pe != nil {
+					panic(res.pe)
+				}
+				return res.out, res.err
+			case <-ctx.Done():
+				return nil, fmt.Errorf("handler timed out after %s: %w", d, ctx.Err())
+			}
+		})
+	}
+}
+
+// LogErrors logs errors returned from the wrapped handler at error level,
+// along with the key and topic of the message that caused them.  The error is
+// still returned.
+func LogErrors[T1, T2 any](logger *slog.Logger) Middleware[T1, T2] {
+	return func(next Handler[T1, T2]) Handler[T1, T2] {
+		return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) ([]Message[T2], error) {
+			out, err := next.Handle(ctx, msg)
+			if err != nil {
+				logger.ErrorContext(ctx, "handler failed",
+					"error", err,
+					"key", msg.Key,
+					"topic", msg.Topic,
+				)
+			}
+			return out, err
+		})
+	}
+}
+
+// SampleDebug logs one in every n messages handled by the wrapped handler at
+// debug level, with the time taken and the number of messages returned.
+func SampleDebug[T1, T2 any](logger *slog.Logger, n int) Middleware[T1, T2] {
+	if n < 1 {
+		n = 1
+	}
+	return func(next Handler[T1, T2]) Handler[T1, T2] {
+		var count atomic.Uint64
+		return HandlerFunc[T1, T2](func(ctx context.Context, msg Message[T1]) ([]Message[T2], error) {
+			if count.Add(1)%uint64(n) != 0 {
+				return next.Handle(ctx, msg)
+			}
+			start := time.Now()
+			out, err := next.Handle(ctx, msg)
+			logger.DebugContext(ctx, "handled message",
+				"key", msg.Key,
+				"topic", msg.Topic,
+				"duration", time.Since(start),
+				"outputs", len(out),
+				"error", err,
+			)
+			return out, err
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	boom := kawa.HandlerFunc[string, string](
+		func(ctx context.Context, m kawa.Message[string]) ([]kawa.Message[string], error) {
+			switch m.Value {
+			case "panic":
+				panic("boom")
+			case "slow":
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+			}
+			return []kawa.Message[string]{m}, nil
+		})
+
+	h := kawa.Wrap[string, string](boom,
+		kawa.Recover[string, string](),
+		kawa.Timeout[string, string](5*time.Millisecond),
+	)
+
+	out, err := h.Handle(context.Background(), kawa.Message[string]{Value: "ok"})
+	require.NoError(t, err)
+	assert.Len(t, out, 1)
+
+	_, err = h.Handle(context.Background(), kawa.Message[string]{Value: "panic"})
+	var pe *kawa.PanicError
+	require.True(t, errors.As(err, &pe), "panics should be recovered through Timeout")
+	assert.Equal(t, "boom", pe.Value)
+	assert.NotEmpty(t, pe.Stack)
+
+	_, err = h.Handle(context.Background(), kawa.Message[string]{Value: "slow"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
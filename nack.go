@@ -0,0 +1,50 @@
+package kawa
+
+import (
+	"context"
+	"time"
+)
+
+// NackFunc negatively acknowledges a message, telling the source that it
+// couldn't be processed and should be redelivered after requeueAfter.  reason
+// describes why processing failed.  A message which has been nacked must not
+// also be acked.
+type NackFunc func(reason error, requeueAfter time.Duration)
+
+// NackSource is implemented by sources which are able to redeliver a message
+// on request, rather than waiting for it to time out unacknowledged.  The
+// Processor prefers RecvWithNack over Recv when the source implements it.  If
+// sending messages to the destination fails and they can all be nacked, the
+// Processor nacks them with a delay which backs off while sends keep failing.
+// It carries on if the error is retryable and the send wasn't already retried
+// according to the Retry option, and otherwise stops with the error.
+type NackSource[T any] interface {
+	Source[T]
+	// RecvWithNack is like Recv, and additionally returns the message's nack
+	// function, which may be nil if the message can't be redelivered.
+	RecvWithNack(context.Context) (Message[T], func(), NackFunc, error)
+}
+
+// Nack is a convenience function for calling the nack function after checking
+// if it's nil.
+func Nack(nack NackFunc, reason error, requeueAfter time.Duration) {
+	if nack != nil {
+		nack(reason, requeueAfter)
+	}
+}
+
+type nackKey struct{}
+
+// ContextWithNack returns a copy of ctx carrying nack.  The Processor passes
+// the nack function of the messages being sent to Destination.Send this way,
+// so that asynchronous destinations can ask for redelivery if writing the
+// messages fails after Send has returned.
+func ContextWithNack(ctx context.Context, nack NackFunc) context.Context {
+	return context.WithValue(ctx, nackKey{}, nack)
+}
+
+// NackFromContext returns the nack function carried by ctx, or nil.
+func NackFromContext(ctx context.Context) NackFunc {
+	nack, _ := ctx.Value(nackKey{}).(NackFunc)
+	return nack
+}
@@ -0,0 +1,154 @@
+package kawa
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var stageTracer = otel.Tracer("kawa/pipeline")
+
+type StageOption func(*StageOpts)
+
+type StageOpts struct {
+	// Name identifies the stage in traces.
+	Name string
+	// Concurrency is the maximum number of messages handled by the stage
+	// concurrently when the previous stage fans out to more than one message.
+	Concurrency int
+	// Tracing records a span for each message handled by the stage.
+	Tracing bool
+}
+
+func StageName(name string) StageOption {
+	return func(o *StageOpts) {
+		o.Name = name
+	}
+}
+
+func StageConcurrency(n int) StageOption {
+	return func(o *StageOpts) {
+		o.Concurrency = n
+	}
+}
+
+func StageTracing(b bool) StageOption {
+	return func(o *StageOpts) {
+		o.Tracing = b
+	}
+}
+
+// Compose chains two handlers into one.  Each message returned from first is
+// passed to second, and the messages returned from second are concatenated in
+// the order that first returned their inputs.  The options configure the
+// second stage.  Longer pipelines are built by composing repeatedly:
+//
+//	parseEnrich := kawa.Compose(parse, enrich, kawa.StageName("enrich"))
+//	pipeline := kawa.Compose(parseEnrich, filter, kawa.StageName("filter"))
+//
+// If either stage returns an error, the composed handler returns it and none
+// of the outputs.
+func Compose[A, B, C any](first Handler[A, B], second Handler[B, C], opts ...StageOption) Handler[A, C] {
+	cfg := StageOpts{Concurrency: 1}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	return composed[A, B, C]{
+		first:  first,
+		second: second,
+		cfg:    cfg,
+	}
+}
+
+type composed[A, B, C any] struct {
+	first  Handler[A, B]
+	second Handler[B, C]
+	cfg    StageOpts
+}
+
+func (c composed[A, B, C]) Handle(ctx context.Context, msg Message[A]) ([]Message[C], error) {
+	mid, err := c.first.Handle(ctx, msg)
+	if err != nil || len(mid) == 0 {
+		return nil, err
+	}
+	if len(mid) == 1 || c.cfg.Concurrency == 1 {
+		var out []Message[C]
+		for _, m := range mid {
+			res, err := c.handleStage(ctx, m)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, res...)
+		}
+		return out, nil
+	}
+	return c.handleConcurrently(ctx, mid)
+}
+
+// handleConcurrently runs the second stage on each message in mid, with up to
+// Concurrency messages in flight at once.
+func (c composed[A, B, C]) handleConcurrently(ctx context.Context, mid []Message[B]) ([]Message[C], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]Message[C], len(mid))
+	sem := make(chan struct{}, c.cfg.Concurrency)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+loop:
+	for i, m := range mid {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func(i int, m Message[B]) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, err := c.handleStage(ctx, m)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = res
+		}(i, m)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var out []Message[C]
+	for _, res := range results {
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+func (c composed[A, B, C]) handleStage(ctx context.Context, msg Message[B]) ([]Message[C], error) {
+	if !c.cfg.Tracing {
+		return c.second.Handle(ctx, msg)
+	}
+	ctx, span := stageTracer.Start(ctx, "kawa.pipeline.stage",
+		trace.WithAttributes(attribute.String("kawa.stage", c.cfg.Name)))
+	out, err := c.second.Handle(ctx, msg)
+	endSpan(span, err)
+	return out, err
+}
@@ -0,0 +1,61 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	// split fans a line out into its words
+	split := kawa.HandlerFunc[string, string](
+		func(ctx context.Context, m kawa.Message[string]) ([]kawa.Message[string], error) {
+			var out []kawa.Message[string]
+			for _, w := range strings.Fields(m.Value) {
+				out = append(out, kawa.Message[string]{Key: m.Key, Value: w})
+			}
+			return out, nil
+		})
+	parse := kawa.HandlerFunc[string, int](
+		func(ctx context.Context, m kawa.Message[string]) ([]kawa.Message[int], error) {
+			n, err := strconv.Atoi(m.Value)
+			if err != nil {
+				return nil, err
+			}
+			return []kawa.Message[int]{{Key: m.Key, Value: n}}, nil
+		})
+	evens := kawa.HandlerFunc[int, int](
+		func(ctx context.Context, m kawa.Message[int]) ([]kawa.Message[int], error) {
+			if m.Value%2 != 0 {
+				return nil, nil
+			}
+			return []kawa.Message[int]{m}, nil
+		})
+
+	for _, concurrency := range []int{1, 4} {
+		pipeline := kawa.Compose(
+			kawa.Compose(split, parse, kawa.StageConcurrency(concurrency)),
+			evens,
+			kawa.StageName("evens"),
+		)
+
+		out, err := pipeline.Handle(context.Background(), kawa.Message[string]{Key: "k", Value: "1 2 3 4 5 6"})
+		require.NoError(t, err)
+		var got []int
+		for _, m := range out {
+			assert.Equal(t, "k", m.Key)
+			got = append(got, m.Value)
+		}
+		assert.Equal(t, []int{2, 4, 6}, got, "concurrency %d", concurrency)
+
+		_, err = pipeline.Handle(context.Background(), kawa.Message[string]{Value: "1 two 3"})
+		var numErr *strconv.NumError
+		assert.True(t, errors.As(err, &numErr), "stage errors should be returned")
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -20,23 +23,74 @@ type Processor[T1, T2 any] struct {
 	src         Source[T1]
 	dst         Destination[T2]
 	handler     Handler[T1, T2]
-	parallelism int
-	tracing     bool
-	metrics     bool
+	deadLetter  Destination[T1]
+	errorPolicy ErrorPolicy
+	retry       *RetryPolicy
+	keyOrdering bool
+	drain       time.Duration
+
+	batchHandler BatchHandler[T1, T2]
+	batchSize    int
+	batchLinger  time.Duration
+
+	state      StateStore
+	checkpoint *checkpointer
+
+	name    string
+	tracer  trace.Tracer
+	metrics *processorMetrics
+	acks    *ackTracker
+	stats   *processorStats
+	ctl     control
+	limiter *limiter
+	// sendFailures counts the sends which have failed in a row, to back off
+	// redelivery of the messages nacked because of them.
+	sendFailures atomic.Int64
 }
 
 type Config[T1, T2 any] struct {
 	Source      Source[T1]
 	Destination Destination[T2]
 	Handler     Handler[T1, T2]
+	// BatchHandler may be set instead of Handler to process messages in
+	// batches.  See the BatchSize and BatchLinger options.
+	BatchHandler BatchHandler[T1, T2]
+
+	// ErrorPolicy determines how errors returned from the Handler are treated.
+	// By default, they're fatal to the processor.
+	ErrorPolicy ErrorPolicy
+	// DeadLetter receives messages which the Handler failed to process when
+	// ErrorPolicy is DeadLetterOnError.  Messages sent to it carry
+	// DeadLetterAttributes describing the failure.
+	DeadLetter Destination[T1]
+
+	// State is made available to the Handler through State.  See the
+	// Checkpoint option for keeping it consistent with the source.
+	State StateStore
 }
 
 type Option func(*Options)
 
 type Options struct {
+	Name        string
 	Parallelism int
+	KeyOrdering bool
 	Tracing     bool
 	Metrics     bool
+	Retry       *RetryPolicy
+	Drain       time.Duration
+	BatchSize   int
+	BatchLinger time.Duration
+	Checkpoint  time.Duration
+	Adaptive    *AdaptiveConfig
+}
+
+// Name sets the name of the processor, which is used to identify it in
+// metrics.  Defaults to "default".
+func Name(name string) func(*Options) {
+	return func(o *Options) {
+		o.Name = name
+	}
 }
 
 func Parallelism(n int) func(*Options) {
@@ -45,80 +99,465 @@ func Parallelism(n int) func(*Options) {
 	}
 }
 
+// KeyOrdering preserves the order of messages with the same Key when
+// Parallelism is greater than one.  Instead of each worker receiving from the
+// source independently, a single receiver hash-partitions messages by Key onto
+// the workers, so every message with a given key is handled and sent by the
+// same worker in the order it was received.  Messages without a Key all share
+// a single partition.
+func KeyOrdering(b bool) func(*Options) {
+	return func(o *Options) {
+		o.KeyOrdering = b
+	}
+}
+
+// Tracing enables OpenTelemetry tracing using the global TracerProvider.  Spans
+// for each message are parented on the span context carried in the message's
+// Attributes, if any (see WithSpanContext), and messages sent to the
+// destination carry the span context of the send.
 func Tracing(b bool) func(*Options) {
 	return func(o *Options) {
 		o.Tracing = b
 	}
 }
 
+// Metrics enables recording of OpenTelemetry metrics using the global
+// MeterProvider.  Each instrument is tagged with the processor's Name.
 func Metrics(b bool) func(*Options) {
 	return func(o *Options) {
 		o.Metrics = b
 	}
 }
 
+// Drain enables graceful shutdown.  When the context passed to Run is done,
+// the processor stops receiving new messages, and waits up to timeout for
+// messages already received to be handled, sent and acknowledged.
+func Drain(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.Drain = timeout
+	}
+}
+
+// BatchSize sets the maximum number of messages passed to a BatchHandler at
+// once.  Defaults to 100.
+func BatchSize(n int) func(*Options) {
+	return func(o *Options) {
+		o.BatchSize = n
+	}
+}
+
+// BatchLinger sets how long to wait for a batch to fill up after receiving the
+// first message of the batch before passing it to a BatchHandler.  Defaults to
+// 50ms.
+func BatchLinger(d time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.BatchLinger = d
+	}
+}
+
+// Retry enables retrying of errors returned from the handler and from sending
+// to the destination, according to the given policy.  Errors from the handler
+// which are still failing once retries are exhausted are subject to the
+// configured ErrorPolicy.  Destination errors remain fatal once exhausted.
+//
+// A failed send is retried with all of its messages, so destinations should
+// only return errors marked with Retryable if none of the messages was
+// accepted, e.g. written or enqueued.  Each attempt is passed its own ack func,
+// and calls to the ack func of a failed attempt are ignored, so a destination
+// which acknowledges asynchronously can't acknowledge messages on behalf of an
+// attempt which failed.
+func Retry(rp RetryPolicy) func(*Options) {
+	return func(o *Options) {
+		o.Retry = &rp
+	}
+}
+
+// Checkpoint snapshots the processor's State every interval.  The State must
+// implement Checkpointer.  Messages aren't acknowledged to the source until
+// a snapshot including the state changes made while handling them has
+// completed, so that after a crash the state and the source's position are
+// consistent: every message whose changes were lost is redelivered.  Changes
+// made by messages which were handled but not yet acknowledged when the
+// snapshot was taken may be applied again on redelivery.  A final snapshot is
+// taken when Run returns.
+func Checkpoint(interval time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.Checkpoint = interval
+	}
+}
+
 // New instantiates a new Processor.  `Processor.Run` must be called after calling `New`
 // before events will be processed.
 func New[T1, T2 any](c Config[T1, T2], opts ...Option) (*Processor[T1, T2], error) {
 	if c.Source == nil || c.Destination == nil {
 		return nil, errors.New("both Source and Destination required")
 	}
-	if c.Handler == nil {
+	if c.Handler == nil && c.BatchHandler == nil {
 		return nil, errors.New("handler required. Have you considered kawa.Pipe?")
 	}
-	var op Options
+	if c.Handler != nil && c.BatchHandler != nil {
+		return nil, errors.New("only one of Handler and BatchHandler may be set")
+	}
+	if c.ErrorPolicy == DeadLetterOnError && c.DeadLetter == nil {
+		return nil, errors.New("DeadLetter destination required for DeadLetterOnError policy")
+	}
+	op := Options{
+		Name:        "default",
+		BatchSize:   100,
+		BatchLinger: 50 * time.Millisecond,
+	}
 	for _, o := range opts {
 		o(&op)
 	}
+	var cp Checkpointer
+	if op.Checkpoint > 0 {
+		var ok bool
+		if cp, ok = c.State.(Checkpointer); !ok {
+			return nil, errors.New("Checkpoint requires a State implementing Checkpointer")
+		}
+	}
+	if op.Adaptive != nil {
+		if op.KeyOrdering {
+			return nil, errors.New("Adaptive can't be combined with KeyOrdering")
+		}
+		if err := op.Adaptive.validate(); err != nil {
+			return nil, err
+		}
+	}
+	pm := newProcessorMetrics(op.Name, op.Metrics)
 	p := &Processor[T1, T2]{
 		src:         c.Source,
 		dst:         c.Destination,
 		handler:     c.Handler,
-		parallelism: op.Parallelism,
-		tracing:     op.Tracing,
-		metrics:     op.Metrics,
+		deadLetter:  c.DeadLetter,
+		errorPolicy: c.ErrorPolicy,
+		retry:       op.Retry,
+		keyOrdering: op.KeyOrdering,
+		drain:       op.Drain,
+
+		batchHandler: c.BatchHandler,
+		batchSize:    op.BatchSize,
+		batchLinger:  op.BatchLinger,
+
+		state: c.State,
+
+		name:    op.Name,
+		tracer:  trace.NewNoopTracerProvider().Tracer("kawa/processor"),
+		metrics: pm,
+		stats:   newProcessorStats(),
+	}
+	if op.Tracing {
+		p.tracer = tracer
+	}
+	if cp != nil {
+		p.checkpoint = &checkpointer{cp: cp, interval: op.Checkpoint}
 	}
+	p.acks = newAckTracker(func() {
+		ctx := context.Background()
+		p.stats.acked.Add(1)
+		pm.acked.Add(ctx, 1, pm.attrs)
+		pm.inflight.Add(ctx, -1, pm.attrs)
+	}, func() {
+		ctx := context.Background()
+		p.stats.nacked.Add(1)
+		pm.nacked.Add(ctx, 1, pm.attrs)
+		pm.inflight.Add(ctx, -1, pm.attrs)
+	})
 
-	if p.parallelism < 1 {
-		p.parallelism = 1
+	p.ctl.parallelism = max(op.Parallelism, 1)
+	if op.Adaptive != nil {
+		p.limiter = newLimiter(*op.Adaptive)
+		p.ctl.parallelism = p.limiter.clamp(p.ctl.parallelism)
+	}
+	if p.batchSize < 1 {
+		p.batchSize = 1
 	}
 	return p, nil
 }
 
-// handle runs the loop to receive, process and send messages.
-func (p *Processor[T1, T2]) handle(ctx context.Context) error {
+// received is a message received from the source along with its tracked
+// acknowledgement functions.
+type received[T any] struct {
+	msg  Message[T]
+	ack  func()
+	nack NackFunc
+	link trace.Link
+}
+
+// recv receives the next message from the source using ctx.
+func (p *Processor[T1, T2]) recv(ctx context.Context) (received[T1], error) {
+	pm := p.metrics
+	if err := p.ctl.wait(ctx); err != nil {
+		return received[T1]{}, fmt.Errorf("source: %w", err)
+	}
+	rctx, recvSpan := p.tracer.Start(ctx, "kawa.processor.src.recv")
+	var (
+		msg  Message[T1]
+		ack  func()
+		nack NackFunc
+		err  error
+	)
+	if ns, ok := p.src.(NackSource[T1]); ok {
+		msg, ack, nack, err = ns.RecvWithNack(rctx)
+	} else {
+		msg, ack, err = p.src.Recv(rctx)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			recvSpan.End()
+		} else {
+			p.recordError(context.Background(), "source", err)
+			endSpan(recvSpan, err)
+		}
+		return received[T1]{}, fmt.Errorf("source: %w", err)
+	}
+	recvSpan.End()
+	p.stats.recordReceive()
+	pm.received.Add(ctx, 1, pm.attrs)
+	pm.inflight.Add(ctx, 1, pm.attrs)
+	if p.checkpoint != nil {
+		ack = p.checkpoint.hold(ack)
+	}
+	ack, nack = p.acks.track(ack, nack)
+	return received[T1]{
+		msg:  msg,
+		ack:  ack,
+		nack: nack,
+		link: trace.LinkFromContext(rctx),
+	}, nil
+}
+
+// errPartitionClosed is returned when receiving from a partition which has
+// been closed by dispatch.
+var errPartitionClosed = errors.New("partition closed")
+
+// handle runs the loop to receive, process and send messages.  Messages are
+// received from next using ctx, and handled and sent using wctx, which
+// outlives ctx when the processor is draining.  The worker's stage is recorded
+// in w.
+func (p *Processor[T1, T2]) handle(ctx, wctx context.Context, w *worker, next recvFunc[T1]) error {
+	if p.batchHandler != nil {
+		return p.handleBatches(ctx, wctx, w, next)
+	}
 	for {
-		ctx, handleSpan := tracer.Start(ctx, "kawa.processor.full")
+		w.set(StageReceiving)
+		r, err := next(ctx)
+		if errors.Is(err, errPartitionClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.process(wctx, w, r); err != nil {
+			return err
+		}
+	}
+}
 
-		rctx, recvSpan := tracer.Start(ctx, "kawa.processor.src.recv")
-		msg, ack, err := p.src.Recv(rctx)
+type recvFunc[T any] func(context.Context) (received[T], error)
+
+// dispatch receives messages using ctx and hands them to the partition
+// selected by hashing each message's Key, so that messages with the same key
+// are always processed by the same worker, in the order they were received.
+// The partitions are closed when dispatch returns.
+func (p *Processor[T1, T2]) dispatch(ctx context.Context, parts []chan received[T1]) error {
+	defer func() {
+		for _, c := range parts {
+			close(c)
+		}
+	}()
+	for {
+		r, err := p.recv(ctx)
 		if err != nil {
-			return fmt.Errorf("source: %w", err)
+			return err
+		}
+		select {
+		case parts[partition(r.msg.Key, len(parts))] <- r:
+		case <-ctx.Done():
+			// The message is left unacknowledged for the source to redeliver.
+			return ctx.Err()
+		}
+	}
+}
+
+// fromPartition receives the messages handed to a partition by dispatch.
+func fromPartition[T any](in <-chan received[T]) recvFunc[T] {
+	return func(ctx context.Context) (received[T], error) {
+		select {
+		case r, ok := <-in:
+			if !ok {
+				return received[T]{}, errPartitionClosed
+			}
+			return r, nil
+		case <-ctx.Done():
+			return received[T]{}, ctx.Err()
 		}
-		recvSpan.End()
+	}
+}
+
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// process handles a single message and sends the results to the destination.
+// Errors returned are fatal to the processor.
+func (p *Processor[T1, T2]) process(ctx context.Context, w *worker, r received[T1]) (err error) {
+	pm := p.metrics
+	msg, ack := r.msg, r.ack
 
-		hctx, hdlSpan := tracer.Start(ctx, "kawa.processor.handler.handle")
-		msgs, err := p.handler.Handle(hctx, msg)
+	// Continue the trace the message arrived with, if any.
+	if sc := SpanContextFromAttributes(msg.Attributes); sc.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	ctx, span := p.tracer.Start(ctx, "kawa.processor.full", trace.WithLinks(r.link))
+	defer func() { endSpan(span, err) }()
+
+	w.set(StageHandling)
+	hctx, hdlSpan := p.tracer.Start(ctx, "kawa.processor.handler.handle")
+	hctx, ha := withHandlerAck(hctx, ack)
+	var msgs []Message[T2]
+	start := time.Now()
+	err = p.withRetry(hctx, func(c context.Context) error {
+		var err error
+		msgs, err = p.handler.Handle(c, msg)
+		return err
+	})
+	pm.handleDuration.Record(ctx, time.Since(start).Seconds(), pm.attrs)
+	endSpan(hdlSpan, err)
+	// The handler may have held back acknowledging the message, or asked to
+	// be notified when its output is acknowledged or fails to be delivered.
+	ack = ha.final()
+	nack := r.nack
+	if ha.isHeld() {
+		// The handler shares responsibility for the message now.
+		nack = nil
+	}
+	if nack != nil {
+		srcNack := nack
+		nack = func(reason error, requeueAfter time.Duration) {
+			ha.fail()
+			srcNack(reason, requeueAfter)
+		}
+	}
+	if err != nil {
+		p.recordError(ctx, "handler", err)
+		err = applyErrorPolicy(ctx, p.errorPolicy, p.deadLetter, "handler", msg, ack, err)
 		if err != nil {
+			ha.fail()
 			return fmt.Errorf("handler: %w", err)
 		}
-		hdlSpan.End()
+		return nil
+	}
+	p.stats.handled.Add(1)
+	pm.handled.Add(ctx, 1, pm.attrs)
 
-		// If there are no messages, we don't need to send nil to destination
-		if len(msgs) == 0 {
-			handleSpan.End()
-			Ack(ack)
-			continue
+	// If there are no messages, we don't need to send nil to destination
+	if len(msgs) == 0 {
+		Ack(ack)
+		return nil
+	}
+
+	w.set(StageSending)
+	sctx, sendSpan := p.tracer.Start(ctx, "kawa.processor.dst.send")
+	if sc := sendSpan.SpanContext(); sc.IsValid() {
+		for i := range msgs {
+			msgs[i].Attributes = WithSpanContext(msgs[i].Attributes, sc)
 		}
+	}
+	if nack != nil {
+		sctx = ContextWithNack(sctx, nack)
+	}
+	start = time.Now()
+	err = p.sendWithRetry(sctx, ack, msgs)
+	pm.sendDuration.Record(ctx, time.Since(start).Seconds(), pm.attrs)
+	endSpan(sendSpan, err)
+	if err != nil {
+		p.recordError(ctx, "destination", err)
+		ha.fail()
+		return p.sendFailed(nack, err)
+	}
+	p.sendFailures.Store(0)
+	p.stats.recordSend(len(msgs))
+	pm.sent.Add(ctx, int64(len(msgs)), pm.attrs)
+	return nil
+}
 
-		sctx, sendSpan := tracer.Start(ctx, "kawa.processor.dst.send")
-		err = p.dst.Send(sctx, ack, msgs...)
+// send sends msgs to the destination, reporting the outcome to the limiter if
+// parallelism is adaptive.  The limiter observes the time until the messages
+// are acknowledged, or until Send fails.
+func (p *Processor[T1, T2]) send(ctx context.Context, ack func(), msgs []Message[T2]) error {
+	if p.limiter == nil {
+		return p.dst.Send(ctx, ack, msgs...)
+	}
+	start := time.Now()
+	var once sync.Once
+	observe := func(err error) {
+		once.Do(func() { p.limiter.observe(time.Since(start), err) })
+	}
+	err := p.dst.Send(ctx, func() {
+		observe(nil)
+		Ack(ack)
+	}, msgs...)
+	if err != nil {
+		observe(err)
+	}
+	return err
+}
+
+// recordError records an error which occurred in stage in the processor's
+// metrics and Stats.
+func (p *Processor[T1, T2]) recordError(ctx context.Context, stage string, err error) {
+	p.metrics.error(ctx, stage)
+	p.stats.recordError(stage, err)
+}
+
+// sendWithRetry sends msgs to the destination according to the processor's
+// retry policy.  Each attempt is given an ack func which is disabled if the
+// attempt fails.
+func (p *Processor[T1, T2]) sendWithRetry(ctx context.Context, ack func(), msgs []Message[T2]) error {
+	if p.retry == nil {
+		return p.send(ctx, ack, msgs)
+	}
+	return p.retry.Do(ctx, func(c context.Context) error {
+		var failed atomic.Bool
+		err := p.send(c, func() {
+			if !failed.Load() {
+				Ack(ack)
+			}
+		}, msgs)
 		if err != nil {
-			return fmt.Errorf("destination: %w", err)
+			failed.Store(true)
 		}
-		sendSpan.End()
-		handleSpan.End()
+		return err
+	})
+}
+
+// sendFailed handles a send failing with err.  If the messages can be nacked,
+// the source is asked to redeliver them after a delay which backs off while
+// sends keep failing.  The processor only carries on if err is retryable and
+// the send wasn't already retried according to its RetryPolicy, otherwise err
+// is fatal and is returned.
+func (p *Processor[T1, T2]) sendFailed(nack NackFunc, err error) error {
+	rp := RetryPolicy{}
+	if p.retry != nil {
+		rp = *p.retry
 	}
+	Nack(nack, err, rp.Backoff(int(p.sendFailures.Add(1))))
+	if nack == nil || p.retry != nil || !IsRetryable(err) {
+		return fmt.Errorf("destination: %w", err)
+	}
+	return nil
+}
+
+// withRetry calls fn according to the processor's retry policy, or exactly
+// once if none is configured.
+func (p *Processor[T1, T2]) withRetry(ctx context.Context, fn func(context.Context) error) error {
+	if p.retry == nil {
+		return fn(ctx)
+	}
+	return p.retry.Do(ctx, fn)
 }
 
 // Run is a blocking call, and runs until either the ctx is canceled, or an
@@ -128,22 +567,108 @@ func (p *Processor[T1, T2]) handle(ctx context.Context) error {
 // error to indicate a clean shutdown was successful.  Run will return
 // ctx.Err() in other cases where context termination leads to shutdown of the
 // processor.
+//
+// If the processor was configured with the Drain option, then once ctx is
+// done Run stops receiving new messages and waits up to the drain timeout for
+// messages already received to be handled, sent and acknowledged before
+// returning.  A *DrainError reporting the number of unacknowledged messages is
+// returned if the timeout expires first.
+//
+// Run may be called again once it has returned, e.g. to restart the processor
+// after a failure.  Messages left unacknowledged by the previous call are no
+// longer counted as in flight.
 func (p *Processor[T1, T2]) Run(ctx context.Context) error {
 	var wg sync.WaitGroup
-	wg.Add(p.parallelism)
-	ctx, cancel := context.WithCancel(ctx)
-	errc := make(chan error, p.parallelism)
-
-	for i := 0; i < p.parallelism; i++ {
-		go func(c context.Context) {
-			if e := p.handle(c); e != nil {
-				errc <- e
+	rctx, cancelRecv := context.WithCancel(ctx)
+	wctx, cancelWork := rctx, cancelRecv
+	if p.drain > 0 {
+		// Work in flight must not be canceled with ctx while draining.
+		wctx, cancelWork = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	if p.state != nil {
+		wctx = withState(wctx, p.state)
+	}
+	// Only the first error is returned, so the rest are dropped rather than
+	// block the workers, whose number can change while running.
+	errc := make(chan error, 1)
+	fail := func(e error) {
+		select {
+		case errc <- e:
+		default:
+		}
+	}
+	spawn := func(fn func() error) {
+		wg.Add(1)
+		go func() {
+			if e := fn(); e != nil {
+				fail(e)
 			}
 			wg.Done()
-		}(ctx)
+		}()
+	}
+	// work spawns a worker running handle, registered in the processor's
+	// Stats while it runs.  Calling the returned func retires the worker
+	// once it's done with its current message.
+	work := func(ctx context.Context, next recvFunc[T1]) context.CancelFunc {
+		wrctx, retire := context.WithCancel(ctx)
+		spawn(func() error {
+			defer retire()
+			w := p.stats.addWorker()
+			defer p.stats.removeWorker(w)
+			err := p.handle(wrctx, wctx, w, next)
+			if wrctx.Err() != nil && ctx.Err() == nil {
+				// retired
+				return nil
+			}
+			return err
+		})
+		return retire
+	}
+	// Messages left behind by a previous Run will be redelivered by the
+	// source, if at all, so they're no longer in flight.
+	if n := p.acks.abandon(); n > 0 {
+		p.metrics.inflight.Add(context.Background(), -int64(n), p.metrics.attrs)
+	}
+	p.stats.setState(StateRunning, nil)
+
+	cpDone := make(chan struct{})
+	cpctx, stopCheckpoints := context.WithCancel(ctx)
+	defer stopCheckpoints()
+	if p.checkpoint != nil {
+		go func() {
+			defer close(cpDone)
+			if e := p.checkpoint.run(cpctx); e != nil {
+				p.stats.recordError("checkpoint", e)
+				fail(fmt.Errorf("checkpoint: %w", e))
+			}
+		}()
+	} else {
+		close(cpDone)
+	}
+
+	if !p.keyOrdering {
+		p.ctl.begin(func() context.CancelFunc { return work(rctx, p.recv) })
+		if p.limiter != nil {
+			spawn(func() error {
+				p.adapt(rctx)
+				return nil
+			})
+		}
+	} else if n := p.ctl.begin(nil); n > 1 {
+		parts := make([]chan received[T1], n)
+		for i := range parts {
+			parts[i] = make(chan received[T1])
+			// Partitions are drained until dispatch closes them, so they're
+			// received from using wctx.
+			work(wctx, fromPartition(parts[i]))
+		}
+		spawn(func() error { return p.dispatch(rctx, parts) })
+	} else {
+		work(rctx, p.recv)
 	}
 
 	var err error
+	var draining bool
 	select {
 	case <-ctx.Done():
 		// context was stopped by parent's cancel or parent timeout.
@@ -153,15 +678,170 @@ func (p *Processor[T1, T2]) Run(ctx context.Context) error {
 		if !errors.Is(ctx.Err(), context.Canceled) {
 			err = ctx.Err()
 		}
+		draining = p.drain > 0
 	case err = <-errc:
 		// All errors are fatal to this worker
 		err = fmt.Errorf("worker: %w", err)
 	}
+	// Stop receiving new messages.
+	p.ctl.stop()
+	cancelRecv()
+	if draining {
+		if unacked := p.drainWorkers(&wg); unacked > 0 {
+			err = &DrainError{Unacked: unacked}
+		}
+	}
 	// Stop all the workers on shutdown.
-	cancel()
+	cancelWork()
 	// TODO: capture errors thrown during shutdown?  if we do this, write local
 	// err first. it represents first seen
 	wg.Wait()
-	close(errc)
+	stopCheckpoints()
+	<-cpDone
+	if p.checkpoint != nil {
+		// Release the acks of everything handled before shutting down.
+		if e := p.checkpoint.snapshot(context.WithoutCancel(ctx)); e != nil {
+			p.stats.recordError("checkpoint", e)
+			if err == nil {
+				err = fmt.Errorf("checkpoint: %w", e)
+			}
+		}
+	}
+	p.stats.setState(StateStopped, err)
 	return err
 }
+
+// drainWorkers waits up to the drain timeout for the workers to finish the
+// messages they're working on and for all received messages to be
+// acknowledged.  It returns the number of messages still unacknowledged.
+func (p *Processor[T1, T2]) drainWorkers(wg *sync.WaitGroup) int {
+	timer := time.NewTimer(p.drain)
+	defer timer.Stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		return p.acks.pending()
+	}
+	select {
+	case <-p.acks.idle():
+	case <-timer.C:
+	}
+	return p.acks.pending()
+}
+
+// DrainError is returned from Run when the drain timeout expired before all
+// received messages were acknowledged.
+type DrainError struct {
+	Unacked int
+}
+
+func (de *DrainError) Error() string {
+	return fmt.Sprintf("drain timed out with %d messages unacknowledged", de.Unacked)
+}
+
+// ackTracker counts messages which have been received but not yet
+// acknowledged.
+type ackTracker struct {
+	mu    sync.Mutex
+	count int
+	zero  chan struct{}
+	// epoch is incremented when the pending messages are abandoned, so that
+	// settling them later isn't counted.
+	epoch  uint64
+	onAck  func()
+	onNack func()
+}
+
+// newAckTracker returns a tracker which calls onAck or onNack, if not nil,
+// whenever a message is first acknowledged or negatively acknowledged.
+func newAckTracker(onAck, onNack func()) *ackTracker {
+	zero := make(chan struct{})
+	close(zero)
+	return &ackTracker{zero: zero, onAck: onAck, onNack: onNack}
+}
+
+// track counts a newly received message and returns ack and nack funcs which
+// call ack or nack and mark the message as settled.  Calling the returned ack
+// func more than once calls ack each time, but only counts the first.  The
+// returned nack func is nil if nack is, and only calls nack if the message
+// hasn't already been settled.
+func (at *ackTracker) track(ack func(), nack NackFunc) (func(), NackFunc) {
+	at.mu.Lock()
+	if at.count == 0 {
+		at.zero = make(chan struct{})
+	}
+	at.count++
+	epoch := at.epoch
+	at.mu.Unlock()
+
+	// settle reports whether this is the first time the message is settled,
+	// and whether it was still counted.
+	var settled atomic.Bool
+	settle := func() (first, counted bool) {
+		if !settled.CompareAndSwap(false, true) {
+			return false, false
+		}
+		at.mu.Lock()
+		defer at.mu.Unlock()
+		if at.epoch != epoch {
+			return true, false
+		}
+		at.count--
+		if at.count == 0 {
+			close(at.zero)
+		}
+		return true, true
+	}
+	trackedAck := func() {
+		Ack(ack)
+		if _, counted := settle(); counted && at.onAck != nil {
+			at.onAck()
+		}
+	}
+	if nack == nil {
+		return trackedAck, nil
+	}
+	return trackedAck, func(reason error, requeueAfter time.Duration) {
+		if first, counted := settle(); first {
+			if counted && at.onNack != nil {
+				at.onNack()
+			}
+			nack(reason, requeueAfter)
+		}
+	}
+}
+
+// abandon stops counting the messages which are pending, e.g. those left
+// unacknowledged by a previous Run which failed, and returns their number.
+// Abandoned messages may still be acknowledged, but they're no longer counted.
+func (at *ackTracker) abandon() int {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	n := at.count
+	if n > 0 {
+		at.count = 0
+		close(at.zero)
+	}
+	at.epoch++
+	return n
+}
+
+func (at *ackTracker) pending() int {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.count
+}
+
+// idle returns a channel which is closed once no messages are pending.
+func (at *ackTracker) idle() <-chan struct{} {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.zero
+}
@@ -2,11 +2,19 @@ package kawa_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/runreveal/kawa"
 	"github.com/runreveal/kawa/x/memory"
+	"github.com/runreveal/kawa/x/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type BinString string
@@ -54,3 +62,547 @@ func TestProcessor(t *testing.T) {
 	}
 
 }
+
+func TestProcessorDeadLetter(t *testing.T) {
+	values := []string{"ok", "bad", "ok"}
+	acked := make(chan string, len(values))
+	var i int
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		if i == len(values) {
+			<-ctx.Done()
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+		v := values[i]
+		i++
+		return kawa.Message[string]{Value: v}, func() { acked <- v }, nil
+	})
+
+	sent := make(chan kawa.Message[string], len(values))
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		for _, m := range msgs {
+			sent <- m
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+	dead := make(chan kawa.Message[string], len(values))
+	dlq := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		for _, m := range msgs {
+			dead <- m
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+
+	errBad := errors.New("bad message")
+	handler := kawa.HandlerFunc[string, string](
+		func(c context.Context, m kawa.Message[string]) ([]kawa.Message[string], error) {
+			if m.Value == "bad" {
+				return nil, errBad
+			}
+			return []kawa.Message[string]{m}, nil
+		})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     handler,
+		ErrorPolicy: kawa.DeadLetterOnError,
+		DeadLetter:  dlq,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	for range values {
+		select {
+		case <-acked:
+		case err := <-errc:
+			t.Fatalf("processor exited early: %v", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for acks")
+		}
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+
+	assert.Len(t, sent, 2)
+	require.Len(t, dead, 1)
+	dl := <-dead
+	assert.Equal(t, "bad", dl.Value)
+	attrs, ok := dl.Attributes.(kawa.DeadLetterAttributes)
+	require.True(t, ok, "dead-lettered message should carry DeadLetterAttributes")
+	assert.ErrorIs(t, attrs.Err, errBad)
+	assert.Equal(t, "handler", attrs.Stage)
+}
+
+func TestDeserSourceSkip(t *testing.T) {
+	values := [][]byte{[]byte(`"one"`), []byte(`{`), []byte(`"two"`)}
+	var acks int
+	var i int
+	src := kawa.SourceFunc[[]byte](func(ctx context.Context) (kawa.Message[[]byte], func(), error) {
+		v := values[i]
+		i++
+		return kawa.Message[[]byte]{Value: v}, func() { acks++ }, nil
+	})
+
+	ds := kawa.NewDeserSource[string](src, kawa.TransformUnmarshalJSON[string],
+		kawa.DeserErrors(kawa.SkipOnError, nil))
+
+	msg, _, err := ds.Recv(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "one", msg.Value)
+
+	msg, _, err = ds.Recv(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "two", msg.Value)
+	assert.Equal(t, 1, acks, "skipped message should be acked")
+
+	ds = kawa.NewDeserSource[string](src, kawa.TransformUnmarshalJSON[string],
+		kawa.DeserErrors(kawa.DeadLetterOnError, nil))
+	_, _, err = ds.Recv(context.Background())
+	assert.Error(t, err, "DeadLetterOnError requires a dead letter destination")
+}
+
+func TestProcessorDrain(t *testing.T) {
+	run := func(t *testing.T, release bool) error {
+		recvd := make(chan struct{})
+		var once bool
+		src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+			if once {
+				<-ctx.Done()
+				return kawa.Message[string]{}, nil, ctx.Err()
+			}
+			once = true
+			close(recvd)
+			return kawa.Message[string]{Value: "hi"}, nil, nil
+		})
+
+		// The destination acks asynchronously, after the processor's context
+		// has been canceled.
+		sent := make(chan func(), 1)
+		dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+			sent <- ack
+			return nil
+		})
+
+		p, err := kawa.New(kawa.Config[string, string]{
+			Source:      src,
+			Destination: dst,
+			Handler:     kawa.Pipe[string](),
+		}, kawa.Drain(50*time.Millisecond))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- p.Run(ctx) }()
+
+		<-recvd
+		ack := <-sent
+		cancel()
+		if release {
+			time.Sleep(10 * time.Millisecond)
+			ack()
+		}
+		return <-errc
+	}
+
+	t.Run("waits for outstanding acks", func(t *testing.T) {
+		assert.NoError(t, run(t, true))
+	})
+
+	t.Run("reports unacked messages", func(t *testing.T) {
+		err := run(t, false)
+		var de *kawa.DrainError
+		require.ErrorAs(t, err, &de)
+		assert.Equal(t, 1, de.Unacked)
+	})
+}
+
+func TestProcessorKeyOrdering(t *testing.T) {
+	const perKey = 50
+	keys := []string{"a", "b", "c", "d"}
+	var n int
+	src := kawa.SourceFunc[int](func(ctx context.Context) (kawa.Message[int], func(), error) {
+		if n == perKey*len(keys) {
+			<-ctx.Done()
+			return kawa.Message[int]{}, nil, ctx.Err()
+		}
+		msg := kawa.Message[int]{Key: keys[n%len(keys)], Value: n / len(keys)}
+		n++
+		return msg, nil, nil
+	})
+
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	done := make(chan struct{})
+	var total int
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, m := range msgs {
+			seen[m.Key] = append(seen[m.Key], m.Value)
+			total++
+		}
+		if total == perKey*len(keys) {
+			close(done)
+		}
+		return nil
+	})
+
+	handler := kawa.HandlerFunc[int, int](func(ctx context.Context, m kawa.Message[int]) ([]kawa.Message[int], error) {
+		// Slow down some messages so that unordered processing would reorder them.
+		if m.Value%3 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return []kawa.Message[int]{m}, nil
+	})
+
+	p, err := kawa.New(kawa.Config[int, int]{
+		Source:      src,
+		Destination: dst,
+		Handler:     handler,
+	}, kawa.Parallelism(4), kawa.KeyOrdering(true))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("timed out")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+
+	for _, k := range keys {
+		require.Len(t, seen[k], perKey)
+		for i, v := range seen[k] {
+			assert.Equal(t, i, v, "messages for key %s should be in order", k)
+		}
+	}
+}
+
+func TestProcessorBatchHandler(t *testing.T) {
+	const total = 10
+	acked := make(chan int, total)
+	var n int
+	src := kawa.SourceFunc[int](func(ctx context.Context) (kawa.Message[int], func(), error) {
+		if n == total {
+			<-ctx.Done()
+			return kawa.Message[int]{}, nil, ctx.Err()
+		}
+		v := n
+		n++
+		return kawa.Message[int]{Value: v}, func() { acked <- v }, nil
+	})
+
+	var mu sync.Mutex
+	var sent []int
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		mu.Lock()
+		for _, m := range msgs {
+			sent = append(sent, m.Value)
+		}
+		mu.Unlock()
+		kawa.Ack(ack)
+		return nil
+	})
+
+	var sizes []int
+	handler := kawa.BatchHandlerFunc[int, int](
+		func(ctx context.Context, msgs []kawa.Message[int]) ([][]kawa.Message[int], error) {
+			sizes = append(sizes, len(msgs))
+			out := make([][]kawa.Message[int], len(msgs))
+			for i, m := range msgs {
+				if m.Value%2 == 0 {
+					out[i] = []kawa.Message[int]{m}
+				}
+			}
+			return out, nil
+		})
+
+	p, err := kawa.New(kawa.Config[int, int]{
+		Source:       src,
+		Destination:  dst,
+		BatchHandler: handler,
+	}, kawa.BatchSize(4), kawa.BatchLinger(20*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	for i := 0; i < total; i++ {
+		select {
+		case <-acked:
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for acks")
+		}
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+
+	assert.Equal(t, []int{4, 4, 2}, sizes)
+	assert.Equal(t, []int{0, 2, 4, 6, 8}, sent)
+}
+
+func TestProcessorBatchLingerKeepsReceiving(t *testing.T) {
+	msgs := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		msgs <- i
+	}
+	var canceled atomic.Int32
+	src := kawa.SourceFunc[int](func(ctx context.Context) (kawa.Message[int], func(), error) {
+		select {
+		case v := <-msgs:
+			return kawa.Message[int]{Value: v}, func() {}, nil
+		case <-ctx.Done():
+			// Sources don't necessarily return the context's error.
+			canceled.Add(1)
+			return kawa.Message[int]{}, nil, errors.New("connection closed")
+		}
+	})
+	batches := make(chan int, 3)
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		batches <- len(msgs)
+		kawa.Ack(ack)
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[int, int]{
+		Source:      src,
+		Destination: dst,
+		BatchHandler: kawa.BatchHandlerFunc[int, int](
+			func(ctx context.Context, msgs []kawa.Message[int]) ([][]kawa.Message[int], error) {
+				out := make([][]kawa.Message[int], len(msgs))
+				for i, m := range msgs {
+					out[i] = []kawa.Message[int]{m}
+				}
+				return out, nil
+			}),
+	}, kawa.BatchSize(10), kawa.BatchLinger(5*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	select {
+	case n := <-batches:
+		assert.Equal(t, 3, n)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the batch")
+	}
+	// Linger expiring several times over must not cancel the receive.
+	time.Sleep(30 * time.Millisecond)
+	assert.Zero(t, canceled.Load())
+	assert.Empty(t, p.Stats().Errors)
+
+	msgs <- 3
+	select {
+	case n := <-batches:
+		assert.Equal(t, 1, n)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the batch")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+type snapshotStore struct {
+	*state.Memory
+	snapshots atomic.Int32
+}
+
+func (ss *snapshotStore) Snapshot(ctx context.Context) error {
+	ss.snapshots.Add(1)
+	return nil
+}
+
+func TestProcessorCheckpoint(t *testing.T) {
+	const total = 3
+	acked := make(chan int, total)
+	var n int
+	src := kawa.SourceFunc[int](func(ctx context.Context) (kawa.Message[int], func(), error) {
+		if n == total {
+			<-ctx.Done()
+			return kawa.Message[int]{}, nil, ctx.Err()
+		}
+		v := n
+		n++
+		return kawa.Message[int]{Value: v}, func() { acked <- v }, nil
+	})
+
+	sent := make(chan int, total)
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		for _, m := range msgs {
+			sent <- m.Value
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+
+	handler := kawa.HandlerFunc[int, int](
+		func(ctx context.Context, m kawa.Message[int]) ([]kawa.Message[int], error) {
+			err := kawa.State(ctx).Put(ctx, "last", []byte(strconv.Itoa(m.Value)))
+			return []kawa.Message[int]{m}, err
+		})
+
+	store := &snapshotStore{Memory: state.NewMemory()}
+	p, err := kawa.New(kawa.Config[int, int]{
+		Source:      src,
+		Destination: dst,
+		Handler:     handler,
+		State:       store,
+	}, kawa.Checkpoint(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	for i := 0; i < total; i++ {
+		select {
+		case <-sent:
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+	assert.Empty(t, acked, "messages should not be acked before a snapshot")
+
+	cancel()
+	assert.NoError(t, <-errc)
+	assert.Equal(t, int32(1), store.snapshots.Load())
+	assert.Len(t, acked, total)
+	v, err := store.Get(context.Background(), "last")
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(v))
+}
+
+type nackSource struct {
+	kawa.SourceFunc[string]
+	nacked chan error
+}
+
+func (ns nackSource) RecvWithNack(ctx context.Context) (kawa.Message[string], func(), kawa.NackFunc, error) {
+	msg, ack, err := ns.Recv(ctx)
+	return msg, ack, func(reason error, _ time.Duration) { ns.nacked <- reason }, err
+}
+
+func TestProcessorNackOnSendFailure(t *testing.T) {
+	redeliver := make(chan string, 1)
+	redeliver <- "hi"
+	acked := make(chan string, 1)
+	src := nackSource{
+		SourceFunc: func(ctx context.Context) (kawa.Message[string], func(), error) {
+			select {
+			case v := <-redeliver:
+				return kawa.Message[string]{Value: v}, func() { acked <- v }, nil
+			case <-ctx.Done():
+				return kawa.Message[string]{}, nil, ctx.Err()
+			}
+		},
+		nacked: make(chan error, 1),
+	}
+	errSend := errors.New("send failed")
+	var sends atomic.Int32
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		assert.NotNil(t, kawa.NackFromContext(ctx), "destination should receive the nack func")
+		if sends.Add(1) == 1 {
+			return kawa.Retryable(errSend)
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	// The retryable send failure is nacked rather than stopping the
+	// processor, so the redelivered message can be sent.
+	select {
+	case reason := <-src.nacked:
+		assert.ErrorIs(t, reason, errSend)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for nack")
+	}
+	redeliver <- "hi"
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for ack")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+	assert.Equal(t, int32(2), sends.Load())
+	assert.Equal(t, uint64(1), p.Stats().Errors["destination"])
+}
+
+func TestProcessorNackPermanentSendFailure(t *testing.T) {
+	in := make(chan string, 1)
+	in <- "hi"
+	errSend := errors.New("send failed")
+	var sends atomic.Int32
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		sends.Add(1)
+		return errSend
+	})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      memory.NewMemSource[string](in),
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// The error isn't retryable, so the message is nacked but the processor
+	// stops rather than sending it again.
+	err = p.Run(ctx)
+	assert.ErrorIs(t, err, errSend)
+	assert.Equal(t, int32(1), sends.Load())
+}
+
+func TestProcessorNackBacksOff(t *testing.T) {
+	in := make(chan string, 1)
+	in <- "hi"
+	var sends atomic.Int32
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		sends.Add(1)
+		return kawa.Retryable(errors.New("unavailable"))
+	})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      memory.NewMemSource[string](in),
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Run(ctx), context.DeadlineExceeded)
+	// Redelivery waits 100ms, then 200ms, after the sends which fail, so
+	// the message is sent about 3 times.
+	n := sends.Load()
+	assert.GreaterOrEqual(t, n, int32(2))
+	assert.LessOrEqual(t, n, int32(4))
+	assert.Equal(t, uint64(n), p.Stats().Errors["destination"])
+}
@@ -0,0 +1,132 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryableError marks the wrapped error as transient.  The default retry
+// classifier, IsRetryable, retries any error which wraps a RetryableError.
+type RetryableError struct {
+	Err error
+}
+
+func (re *RetryableError) Error() string {
+	return re.Err.Error()
+}
+
+func (re *RetryableError) Unwrap() error {
+	return re.Err
+}
+
+// Retryable wraps err to signal that the operation which returned it may be
+// retried.  Retryable returns nil if err is nil.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// IsRetryable reports whether any error in err's chain was marked with
+// Retryable.
+func IsRetryable(err error) bool {
+	var re *RetryableError
+	return errors.As(err, &re)
+}
+
+// RetryPolicy describes how an operation is retried.  The delay between
+// attempts starts at InitialBackoff and grows by Multiplier after each attempt
+// up to MaxBackoff.  Each delay is reduced by a random amount up to Jitter
+// (a fraction between 0 and 1) of itself to avoid retrying in lockstep.
+//
+// Zero values are replaced with sensible defaults, so RetryPolicy{} makes up
+// to 5 attempts at operations failing with errors marked with Retryable.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Defaults to 5.  Negative values retry until the operation succeeds,
+	// fails with an error which isn't retryable, or the context is done.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	// IsRetryable classifies errors as retryable.  Defaults to IsRetryable.
+	IsRetryable func(error) bool
+}
+
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.MaxAttempts == 0 {
+		rp.MaxAttempts = 5
+	}
+	if rp.InitialBackoff <= 0 {
+		rp.InitialBackoff = 100 * time.Millisecond
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = 30 * time.Second
+	}
+	if rp.MaxBackoff < rp.InitialBackoff {
+		rp.MaxBackoff = rp.InitialBackoff
+	}
+	if rp.Multiplier < 1 {
+		rp.Multiplier = 2
+	}
+	if rp.Jitter < 0 {
+		rp.Jitter = 0
+	}
+	if rp.Jitter > 1 {
+		rp.Jitter = 1
+	}
+	if rp.IsRetryable == nil {
+		rp.IsRetryable = IsRetryable
+	}
+	return rp
+}
+
+// Backoff returns the delay to wait after the given attempt (starting at 1)
+// fails, before making the next attempt.
+func (rp RetryPolicy) Backoff(attempt int) time.Duration {
+	rp = rp.withDefaults()
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(rp.InitialBackoff) * math.Pow(rp.Multiplier, float64(attempt-1))
+	if d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d -= d * rp.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, returns an error which isn't retryable, or
+// the attempts are exhausted.  The last error returned from fn is returned.
+// If ctx is done while waiting to retry, ctx.Err() is returned.
+//
+// Do is exported so that sources and destinations can share the same retry
+// behavior as the processor.
+func (rp RetryPolicy) Do(ctx context.Context, fn func(context.Context) error) error {
+	rp = rp.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !rp.IsRetryable(err) {
+			return err
+		}
+		if rp.MaxAttempts > 0 && attempt >= rp.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		t := time.NewTimer(rp.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
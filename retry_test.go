@@ -0,0 +1,132 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	rp := kawa.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		Jitter:         0.5,
+	}
+	transient := errors.New("transient")
+
+	t.Run("retries until success", func(t *testing.T) {
+		calls := 0
+		err := rp.Do(context.Background(), func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return kawa.Retryable(transient)
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		calls := 0
+		err := rp.Do(context.Background(), func(context.Context) error {
+			calls++
+			return kawa.Retryable(transient)
+		})
+		assert.ErrorIs(t, err, transient)
+		assert.True(t, kawa.IsRetryable(err))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("doesn't retry permanent errors", func(t *testing.T) {
+		calls := 0
+		err := rp.Do(context.Background(), func(context.Context) error {
+			calls++
+			return transient
+		})
+		assert.ErrorIs(t, err, transient)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		rp := rp
+		rp.IsRetryable = func(err error) bool { return errors.Is(err, transient) }
+		calls := 0
+		err := rp.Do(context.Background(), func(context.Context) error {
+			calls++
+			return transient
+		})
+		assert.ErrorIs(t, err, transient)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("backoff is bounded", func(t *testing.T) {
+		for i := 1; i < 10; i++ {
+			assert.LessOrEqual(t, rp.Backoff(i), rp.MaxBackoff)
+		}
+	})
+}
+
+func TestRetryPolicyDefaultAttempts(t *testing.T) {
+	rp := kawa.RetryPolicy{InitialBackoff: time.Microsecond}
+	calls := 0
+	err := rp.Do(context.Background(), func(context.Context) error {
+		calls++
+		return kawa.Retryable(errors.New("transient"))
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 5, calls)
+}
+
+func TestProcessorRetrySendAck(t *testing.T) {
+	msgs := make(chan kawa.Message[string], 1)
+	msgs <- kawa.Message[string]{Value: "hi"}
+	acked := make(chan struct{}, 2)
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case m := <-msgs:
+			return m, func() { acked <- struct{}{} }, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	// The first attempt acknowledges before failing, as an asynchronous
+	// destination might.  Only the successful attempt's ack counts.
+	var attempts int
+	var firstAck func()
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		attempts++
+		if attempts == 1 {
+			firstAck = ack
+			return kawa.Retryable(errors.New("transient"))
+		}
+		firstAck()
+		assert.Empty(t, acked, "failed attempt's ack should be ignored")
+		ack()
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Retry(kawa.RetryPolicy{InitialBackoff: time.Millisecond}))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("message wasn't acknowledged")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, acked, "message should be acknowledged once")
+}
@@ -0,0 +1,107 @@
+package kawa
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKeyNotFound is returned from StateStore.Get when there's no value stored
+// under the key.
+var ErrKeyNotFound = errors.New("key not found")
+
+// StateStore is a key-value store which handlers use to keep state across
+// messages, e.g. running counts.  The processor's store is available to
+// handlers through State.  Implementations must be safe for concurrent use.
+type StateStore interface {
+	// Get returns the value stored under key, or ErrKeyNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	// Scan calls fn for each key with the given prefix, in key order, until fn
+	// returns an error.
+	Scan(ctx context.Context, prefix string, fn func(key string, value []byte) error) error
+}
+
+// Checkpointer is implemented by state stores which persist their state.
+// Snapshot durably persists all of the changes made to the store so far.
+type Checkpointer interface {
+	Snapshot(ctx context.Context) error
+}
+
+type stateKey struct{}
+
+func withState(ctx context.Context, ss StateStore) context.Context {
+	return context.WithValue(ctx, stateKey{}, ss)
+}
+
+// State returns the StateStore of the processor running the handler ctx was
+// passed to, or nil if the processor wasn't configured with one.
+func State(ctx context.Context) StateStore {
+	ss, _ := ctx.Value(stateKey{}).(StateStore)
+	return ss
+}
+
+// checkpointer coordinates snapshots of the state store with acknowledgement
+// of messages.  Acks are held until the state changes made while handling the
+// message have been included in a snapshot, so that after a crash the source
+// redelivers every message whose effects on the state were lost.
+type checkpointer struct {
+	cp       Checkpointer
+	interval time.Duration
+
+	mu   sync.Mutex
+	held []func()
+}
+
+// hold returns an ack func which holds on to ack until the next snapshot.
+// Only the first call is held.
+func (c *checkpointer) hold(ack func()) func() {
+	var called atomic.Bool
+	return func() {
+		if ack == nil || !called.CompareAndSwap(false, true) {
+			return
+		}
+		c.mu.Lock()
+		c.held = append(c.held, ack)
+		c.mu.Unlock()
+	}
+}
+
+// snapshot snapshots the state store and then calls the acks held until now.
+// If the snapshot fails, the acks stay held for the next attempt.
+func (c *checkpointer) snapshot(ctx context.Context) error {
+	c.mu.Lock()
+	acks := c.held
+	c.held = nil
+	c.mu.Unlock()
+
+	if err := c.cp.Snapshot(ctx); err != nil {
+		c.mu.Lock()
+		c.held = append(acks, c.held...)
+		c.mu.Unlock()
+		return err
+	}
+	for _, ack := range acks {
+		ack()
+	}
+	return nil
+}
+
+// run snapshots the state store every interval until ctx is done.
+func (c *checkpointer) run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.snapshot(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package kawa
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerStage is what a processor's worker is currently doing.
+type WorkerStage string
+
+const (
+	StageReceiving WorkerStage = "receiving"
+	StageHandling  WorkerStage = "handling"
+	StageSending   WorkerStage = "sending"
+)
+
+// WorkerStatus describes the current activity of one of a processor's
+// workers.
+type WorkerStatus struct {
+	ID    int         `json:"id"`
+	Stage WorkerStage `json:"stage"`
+	// Since is when the worker entered its current stage.
+	Since time.Time `json:"since"`
+}
+
+// Stats is a snapshot of a processor's activity since it was created.
+type Stats struct {
+	Received uint64 `json:"received"`
+	Handled  uint64 `json:"handled"`
+	Sent     uint64 `json:"sent"`
+	Acked    uint64 `json:"acked"`
+	Nacked   uint64 `json:"nacked"`
+	// Errors counts errors by the stage they occurred in: "source",
+	// "handler", "destination" or "checkpoint".
+	Errors map[string]uint64 `json:"errors"`
+	// InFlight is the number of messages received but not yet acknowledged.
+	InFlight int `json:"in_flight"`
+	// Parallelism is the number of workers the processor runs.  With the
+	// Adaptive option, it's the current limit chosen by the limiter.
+	Parallelism int `json:"parallelism"`
+
+	LastReceive   time.Time `json:"last_receive"`
+	LastSend      time.Time `json:"last_send"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time"`
+
+	Workers []WorkerStatus `json:"workers"`
+}
+
+// SinceLastReceive returns the time since a message was last received, or 0
+// if none has been.
+func (s Stats) SinceLastReceive() time.Duration {
+	return since(s.LastReceive)
+}
+
+// SinceLastSend returns the time since messages were last sent, or 0 if none
+// have been.
+func (s Stats) SinceLastSend() time.Duration {
+	return since(s.LastSend)
+}
+
+func since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// RunState is the lifecycle state of a processor.
+type RunState string
+
+const (
+	StateIdle    RunState = "idle"
+	StateRunning RunState = "running"
+	// StatePaused is reported while a running processor is paused.
+	StatePaused  RunState = "paused"
+	StateStopped RunState = "stopped"
+)
+
+// Status is the state of a processor along with its Stats.
+type Status struct {
+	Name  string   `json:"name"`
+	State RunState `json:"state"`
+	// Err is the error Run returned, if the processor has stopped.
+	Err string `json:"error,omitempty"`
+	Stats
+}
+
+// Stats returns a snapshot of the processor's activity.
+func (p *Processor[T1, T2]) Stats() Stats {
+	s := p.stats.snapshot()
+	s.InFlight = p.acks.pending()
+	s.Parallelism = p.parallelism()
+	return s
+}
+
+// Status returns the processor's state and a snapshot of its activity.
+func (p *Processor[T1, T2]) Status() Status {
+	state, err := p.stats.state()
+	if state == StateRunning && p.Paused() {
+		state = StatePaused
+	}
+	return Status{
+		Name:  p.name,
+		State: state,
+		Err:   err,
+		Stats: p.Stats(),
+	}
+}
+
+// HealthHandler returns an http.Handler which serves the processor's Status as
+// JSON, for use as liveness and readiness probes:
+//
+//   - Requests to a path ending in /ready succeed only while the processor is
+//     running, including while it's paused.
+//   - Requests to a path ending in /live fail if the processor stopped with an
+//     error, or if any worker has been handling or sending a message for
+//     longer than stallTimeout, if it's positive.  Waiting to receive isn't
+//     considered stalled, as the source may simply be idle.
+//   - Other requests always succeed.
+//
+// Failing probes respond with 503 Service Unavailable.
+func (p *Processor[T1, T2]) HealthHandler(stallTimeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := p.Status()
+		healthy := true
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/ready"):
+			healthy = st.State == StateRunning || st.State == StatePaused
+		case strings.HasSuffix(r.URL.Path, "/live"):
+			healthy = st.Err == "" && !stalled(st.Workers, stallTimeout)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(st)
+	})
+}
+
+func stalled(workers []WorkerStatus, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+	for _, w := range workers {
+		if w.Stage != StageReceiving && time.Since(w.Since) > timeout {
+			return true
+		}
+	}
+	return false
+}
+
+// processorStats records the activity reported by Stats.
+type processorStats struct {
+	received atomic.Uint64
+	handled  atomic.Uint64
+	sent     atomic.Uint64
+	acked    atomic.Uint64
+	nacked   atomic.Uint64
+
+	lastReceive atomic.Int64
+	lastSend    atomic.Int64
+
+	mu        sync.Mutex
+	errors    map[string]uint64
+	lastErr   string
+	lastErrAt time.Time
+	st        RunState
+	exitErr   string
+	workers   map[int]*worker
+	nextID    int
+}
+
+func newProcessorStats() *processorStats {
+	return &processorStats{
+		errors:  make(map[string]uint64),
+		st:      StateIdle,
+		workers: make(map[int]*worker),
+	}
+}
+
+func (ps *processorStats) recordReceive() {
+	ps.received.Add(1)
+	ps.lastReceive.Store(time.Now().UnixNano())
+}
+
+func (ps *processorStats) recordSend(n int) {
+	ps.sent.Add(uint64(n))
+	ps.lastSend.Store(time.Now().UnixNano())
+}
+
+func (ps *processorStats) recordError(stage string, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.errors[stage]++
+	ps.lastErr = err.Error()
+	ps.lastErrAt = time.Now()
+}
+
+func (ps *processorStats) setState(s RunState, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.st = s
+	ps.exitErr = ""
+	if err != nil {
+		ps.exitErr = err.Error()
+	}
+}
+
+func (ps *processorStats) state() (RunState, string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.st, ps.exitErr
+}
+
+func (ps *processorStats) addWorker() *worker {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	w := &worker{id: ps.nextID, stage: StageReceiving, since: time.Now()}
+	ps.nextID++
+	ps.workers[w.id] = w
+	return w
+}
+
+func (ps *processorStats) removeWorker(w *worker) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.workers, w.id)
+}
+
+func (ps *processorStats) snapshot() Stats {
+	s := Stats{
+		Received:    ps.received.Load(),
+		Handled:     ps.handled.Load(),
+		Sent:        ps.sent.Load(),
+		Acked:       ps.acked.Load(),
+		Nacked:      ps.nacked.Load(),
+		LastReceive: unixNano(ps.lastReceive.Load()),
+		LastSend:    unixNano(ps.lastSend.Load()),
+		Errors:      make(map[string]uint64),
+	}
+	ps.mu.Lock()
+	for k, v := range ps.errors {
+		s.Errors[k] = v
+	}
+	s.LastError, s.LastErrorTime = ps.lastErr, ps.lastErrAt
+	workers := make([]*worker, 0, len(ps.workers))
+	for _, w := range ps.workers {
+		workers = append(workers, w)
+	}
+	ps.mu.Unlock()
+
+	for _, w := range workers {
+		s.Workers = append(s.Workers, w.status())
+	}
+	sort.Slice(s.Workers, func(i, j int) bool { return s.Workers[i].ID < s.Workers[j].ID })
+	return s
+}
+
+func unixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// worker tracks the stage of one of the processor's workers.
+type worker struct {
+	id    int
+	mu    sync.Mutex
+	stage WorkerStage
+	since time.Time
+}
+
+// set records that the worker entered stage.  It's safe to call on a nil
+// worker.
+func (w *worker) set(stage WorkerStage) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stage = stage
+	w.since = time.Now()
+}
+
+func (w *worker) status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WorkerStatus{ID: w.id, Stage: w.stage, Since: w.since}
+}
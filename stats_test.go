@@ -0,0 +1,95 @@
+package kawa_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorStats(t *testing.T) {
+	values := []string{"a", "b", "stuck"}
+	var n int
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		if n == len(values) {
+			<-ctx.Done()
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+		n++
+		return kawa.Message[string]{Value: values[n-1]}, func() {}, nil
+	})
+	release := make(chan struct{})
+	handler := kawa.HandlerFunc[string, string](func(ctx context.Context, msg kawa.Message[string]) ([]kawa.Message[string], error) {
+		if msg.Value == "stuck" {
+			<-release
+		}
+		return []kawa.Message[string]{msg}, nil
+	})
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		kawa.Ack(ack)
+		return nil
+	})
+
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     handler,
+	}, kawa.Name("stats"))
+	require.NoError(t, err)
+	assert.Equal(t, kawa.StateIdle, p.Status().State)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		s := p.Stats()
+		return s.Handled == 2 && len(s.Workers) == 1 && s.Workers[0].Stage == kawa.StageHandling
+	}, time.Second, time.Millisecond)
+
+	st := p.Status()
+	assert.Equal(t, "stats", st.Name)
+	assert.Equal(t, kawa.StateRunning, st.State)
+	assert.Equal(t, uint64(3), st.Received)
+	assert.Equal(t, uint64(2), st.Sent)
+	assert.Equal(t, uint64(2), st.Acked)
+	assert.Equal(t, 1, st.InFlight)
+	assert.False(t, st.LastReceive.IsZero())
+	assert.Greater(t, st.SinceLastSend(), time.Duration(0))
+
+	get := func(h http.Handler, path string) (int, kawa.Status) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var st kawa.Status
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&st))
+		return rec.Code, st
+	}
+	code, body := get(p.HealthHandler(0), "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, kawa.StateRunning, body.State)
+	code, _ = get(p.HealthHandler(time.Hour), "/live")
+	assert.Equal(t, http.StatusOK, code)
+	time.Sleep(5 * time.Millisecond)
+	code, _ = get(p.HealthHandler(time.Millisecond), "/live")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "stuck handler should fail liveness")
+
+	close(release)
+	require.Eventually(t, func() bool { return p.Stats().Acked == 3 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	st = p.Status()
+	assert.Equal(t, kawa.StateStopped, st.State)
+	assert.Empty(t, st.Workers)
+	assert.Equal(t, 0, st.InFlight)
+	code, _ = get(p.HealthHandler(0), "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = get(p.HealthHandler(0), "/live")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,68 @@
+package kawa
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceAttributes carry a span context along with a message so that spans
+// started while processing the message can be linked to the trace it was
+// produced in, e.g. a W3C traceparent received by a source.
+type TraceAttributes struct {
+	SpanContext trace.SpanContext
+	Wrapped     Attributes
+}
+
+func (ta TraceAttributes) Unwrap() Attributes {
+	return ta.Wrapped
+}
+
+// WithSpanContext returns attrs wrapped with TraceAttributes carrying sc.  attrs
+// is returned unchanged if sc is not valid.
+func WithSpanContext(attrs Attributes, sc trace.SpanContext) Attributes {
+	if !sc.IsValid() {
+		return attrs
+	}
+	return TraceAttributes{SpanContext: sc, Wrapped: attrs}
+}
+
+// SpanContextFromAttributes returns the span context carried by the first
+// TraceAttributes found in the attrs chain, or an invalid span context if
+// there is none.
+func SpanContextFromAttributes(attrs Attributes) trace.SpanContext {
+	ta, _ := AttributesAs[TraceAttributes](attrs)
+	return ta.SpanContext
+}
+
+// ExtractTraceContext reads W3C trace context (the traceparent and tracestate
+// headers) from carrier and returns attrs wrapped with the span context found.
+// Sources use it to propagate traces from headers or message properties, e.g.
+//
+//	attrs := kawa.ExtractTraceContext(nil, propagation.HeaderCarrier(r.Header))
+func ExtractTraceContext(attrs Attributes, carrier propagation.TextMapCarrier) Attributes {
+	ctx := propagation.TraceContext{}.Extract(context.Background(), carrier)
+	return WithSpanContext(attrs, trace.SpanContextFromContext(ctx))
+}
+
+// InjectTraceContext writes the span context carried by attrs to carrier as W3C
+// trace context headers.  Destinations use it to propagate traces downstream.
+func InjectTraceContext(attrs Attributes, carrier propagation.TextMapCarrier) {
+	sc := SpanContextFromAttributes(attrs)
+	if !sc.IsValid() {
+		return
+	}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), sc)
+	propagation.TraceContext{}.Inject(ctx, carrier)
+}
+
+// endSpan records err on span, if not nil, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
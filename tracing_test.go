@@ -0,0 +1,230 @@
+package kawa_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type testAttrs struct{}
+
+func (testAttrs) Unwrap() kawa.Attributes { return nil }
+
+func TestTraceContextPropagation(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	in := propagation.MapCarrier{"traceparent": traceparent}
+
+	attrs := kawa.ExtractTraceContext(testAttrs{}, in)
+	sc := kawa.SpanContextFromAttributes(attrs)
+	require.True(t, sc.IsValid())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, testAttrs{}, attrs.Unwrap(), "original attributes should be wrapped")
+
+	out := propagation.MapCarrier{}
+	kawa.InjectTraceContext(attrs, out)
+	assert.Equal(t, traceparent, out.Get("traceparent"))
+
+	none := kawa.ExtractTraceContext(nil, propagation.MapCarrier{})
+	assert.Nil(t, none, "attributes shouldn't be wrapped without a trace context")
+}
+
+var (
+	spanExporter    = tracetest.NewInMemoryExporter()
+	installExporter sync.Once
+)
+
+// recordSpans returns an exporter recording the spans ended by processors
+// with the Tracing option.  The processor's tracer only ever delegates to the
+// first global TracerProvider set, so a single exporter is shared by all
+// tests, and reset at the start of each.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	installExporter.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+func spansNamed(exp *tracetest.InMemoryExporter, name string) tracetest.SpanStubs {
+	var res tracetest.SpanStubs
+	for _, s := range exp.GetSpans() {
+		if s.Name == name {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// runTraced runs a processor over msgs until all of them have been settled
+// or Run fails, and returns Run's error.
+func runTraced(t *testing.T, cfg kawa.Config[string, string], msgs []kawa.Message[string], opts ...kawa.Option) error {
+	in := make(chan kawa.Message[string], len(msgs))
+	for _, m := range msgs {
+		in <- m
+	}
+	settled := make(chan struct{}, len(msgs))
+	cfg.Source = kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case m := <-in:
+			return m, func() { settled <- struct{}{} }, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	p, err := kawa.New(cfg, opts...)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	for range msgs {
+		select {
+		case <-settled:
+		case err := <-done:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for messages to be acknowledged")
+		}
+	}
+	cancel()
+	return <-done
+}
+
+var parentSC = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{1},
+	SpanID:     trace.SpanID{2},
+	TraceFlags: trace.FlagsSampled,
+	Remote:     true,
+})
+
+func TestProcessorTracing(t *testing.T) {
+	sr := recordSpans(t)
+	var sentSC trace.SpanContext
+	cfg := kawa.Config[string, string]{
+		Handler: kawa.Pipe[string](),
+		Destination: kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+			sentSC = kawa.SpanContextFromAttributes(msgs[0].Attributes)
+			kawa.Ack(ack)
+			return nil
+		}),
+	}
+	msgs := []kawa.Message[string]{{Value: "hi", Attributes: kawa.WithSpanContext(nil, parentSC)}}
+
+	// Without the Tracing option, no spans are recorded.
+	require.NoError(t, runTraced(t, cfg, msgs))
+	assert.Empty(t, sr.GetSpans())
+
+	require.NoError(t, runTraced(t, cfg, msgs, kawa.Tracing(true)))
+	full := spansNamed(sr, "kawa.processor.full")
+	require.Len(t, full, 1)
+	// The message's span continues the trace carried in its attributes.
+	assert.Equal(t, parentSC.TraceID(), full[0].SpanContext.TraceID())
+	assert.Equal(t, parentSC.SpanID(), full[0].Parent.SpanID())
+	assert.Equal(t, codes.Unset, full[0].Status.Code)
+
+	// The full span is linked to the receive of the message.
+	recv := spansNamed(sr, "kawa.processor.src.recv")
+	require.NotEmpty(t, recv)
+	require.Len(t, full[0].Links, 1)
+	assert.Equal(t, recv[0].SpanContext.SpanID(), full[0].Links[0].SpanContext.SpanID())
+
+	// Messages sent carry the span context of the send.
+	send := spansNamed(sr, "kawa.processor.dst.send")
+	require.Len(t, send, 1)
+	assert.Equal(t, send[0].SpanContext, sentSC)
+	require.Len(t, spansNamed(sr, "kawa.processor.handler.handle"), 1)
+}
+
+func TestProcessorBatchTracingLinks(t *testing.T) {
+	sr := recordSpans(t)
+	cfg := kawa.Config[string, string]{
+		BatchHandler: kawa.BatchHandlerFunc[string, string](func(ctx context.Context, msgs []kawa.Message[string]) ([][]kawa.Message[string], error) {
+			res := make([][]kawa.Message[string], len(msgs))
+			for i, m := range msgs {
+				res[i] = []kawa.Message[string]{m}
+			}
+			return res, nil
+		}),
+		Destination: kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+			kawa.Ack(ack)
+			return nil
+		}),
+	}
+	other := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{3},
+		SpanID:     trace.SpanID{4},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	msgs := []kawa.Message[string]{
+		{Value: "a", Attributes: kawa.WithSpanContext(nil, parentSC)},
+		{Value: "b", Attributes: kawa.WithSpanContext(nil, other)},
+	}
+	require.NoError(t, runTraced(t, cfg, msgs, kawa.Tracing(true), kawa.BatchSize(2), kawa.BatchLinger(time.Second)))
+
+	batch := spansNamed(sr, "kawa.processor.batch")
+	require.Len(t, batch, 1)
+	var linked []trace.SpanContext
+	for _, l := range batch[0].Links {
+		linked = append(linked, l.SpanContext)
+	}
+	assert.Contains(t, linked, parentSC)
+	assert.Contains(t, linked, other)
+}
+
+func TestProcessorTracingErrors(t *testing.T) {
+	errHandle := errors.New("handle failed")
+	errSend := errors.New("send failed")
+	msgs := []kawa.Message[string]{{Value: "hi"}}
+
+	t.Run("handler", func(t *testing.T) {
+		sr := recordSpans(t)
+		cfg := kawa.Config[string, string]{
+			Handler: kawa.HandlerFunc[string, string](func(ctx context.Context, msg kawa.Message[string]) ([]kawa.Message[string], error) {
+				return nil, errHandle
+			}),
+			Destination: kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+				return nil
+			}),
+		}
+		assert.ErrorIs(t, runTraced(t, cfg, msgs, kawa.Tracing(true)), errHandle)
+		for _, name := range []string{"kawa.processor.handler.handle", "kawa.processor.full"} {
+			spans := spansNamed(sr, name)
+			require.Len(t, spans, 1, name)
+			assert.Equal(t, codes.Error, spans[0].Status.Code, name)
+		}
+		assert.Empty(t, spansNamed(sr, "kawa.processor.dst.send"))
+	})
+
+	t.Run("destination", func(t *testing.T) {
+		sr := recordSpans(t)
+		cfg := kawa.Config[string, string]{
+			Handler: kawa.Pipe[string](),
+			Destination: kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+				return errSend
+			}),
+		}
+		assert.ErrorIs(t, runTraced(t, cfg, msgs, kawa.Tracing(true)), errSend)
+		for _, name := range []string{"kawa.processor.dst.send", "kawa.processor.full"} {
+			spans := spansNamed(sr, name)
+			require.Len(t, spans, 1, name)
+			assert.Equal(t, codes.Error, spans[0].Status.Code, name)
+		}
+		handle := spansNamed(sr, "kawa.processor.handler.handle")
+		require.Len(t, handle, 1)
+		assert.Equal(t, codes.Unset, handle[0].Status.Code)
+	})
+}
@@ -3,6 +3,8 @@ package kawa
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"time"
 )
 
 // Message is the data wrapper which accepts any serializable type as it's
@@ -19,6 +21,19 @@ type Message[T any] struct {
 	// Topic indicates which topic this message came from (if applicable).  It
 	// should not be used as a means to set the output topic for destinations.
 	Topic string
+	// ID uniquely identifies this message, e.g. for deduplication or to
+	// correlate it across systems.  Sources set it from the message's own
+	// identifier when there is one, and may generate one otherwise.
+	ID string
+	// EventTime is when the event described by this message occurred,
+	// according to its producer.  It's zero if unknown.
+	EventTime time.Time
+	// IngestTime is when the source received this message.  It's zero if the
+	// source doesn't record it.
+	IngestTime time.Time
+	// Headers are string metadata carried along with the message, such as
+	// protocol headers or properties.  See Header and SetHeader.
+	Headers map[string]string
 	// Attributes are inspired by context.Context and are used as a means to pass
 	// metadata from a source implementation through to a consumer.  See examples
 	// for details.
@@ -49,7 +64,8 @@ type Source[T any] interface {
 	// the message returned from Recv has been successfully written to it's
 	// destination.  It should not be called twice.  Sources may panic in that
 	// scenario as it indicates a logical flaw for delivery guarantees within the
-	// program.
+	// program.  Sources which can redeliver messages on request should also
+	// implement NackSource.
 	//
 	// In the case of sending to multiple destinations, or teeing the data stream
 	// inside a processor's handler function, then the programmer must decide
@@ -94,12 +110,16 @@ type Destination[T any] interface {
 	// successfully written to the Destination.
 	//
 	// All errors which are retryable must be handled inside the Send func, or
-	// otherwise handled internally.  Any errors returned from Send indicate a
-	// fatal error to the processor, and the processor will terminate.  If you
-	// want to be able to delegate the responsibility of deciding retryable
-	// errors to the user of the Destination, then allow the user to register a
-	// callback, e.g. `IsRetryable(err error) bool`, when instantiating a
-	// Destination.
+	// otherwise handled internally, unless the processor is configured with a
+	// RetryPolicy (see the Retry option), in which case errors wrapped with
+	// Retryable will be retried by the processor.  Without a RetryPolicy,
+	// retryable errors from sending messages received from a NackSource are
+	// handled by nacking the messages for redelivery.  Any other errors
+	// returned from Send indicate a fatal error to the processor, and the
+	// processor will terminate.  If you want to be able to delegate the responsibility of
+	// deciding retryable errors to the user of the Destination, then allow the
+	// user to register a callback, e.g. `IsRetryable(err error) bool`, when
+	// instantiating a Destination.
 	//
 	// The second argument value is the acknowlegement function.  Ack is called
 	// when the message has been successfully written to the Destination.  It
@@ -167,29 +187,95 @@ func TransformUnmarshalJSON[T any](bs []byte) (T, error) {
 }
 
 type DeserializationSource[T any] struct {
-	src   ByteSource
-	deser func([]byte) (T, error)
+	src         ByteSource
+	deser       func([]byte) (T, error)
+	errorPolicy ErrorPolicy
+	deadLetter  Destination[[]byte]
+	// err reports invalid options, and is returned from Recv.
+	err error
+}
+
+type DeserOption func(*DeserOpts)
+
+type DeserOpts struct {
+	ErrorPolicy ErrorPolicy
+	DeadLetter  Destination[[]byte]
+}
+
+// DeserErrors sets the policy applied to messages which fail to deserialize.
+// deadLetter receives the raw message when policy is DeadLetterOnError, and
+// may be nil otherwise.
+func DeserErrors(policy ErrorPolicy, deadLetter Destination[[]byte]) DeserOption {
+	return func(o *DeserOpts) {
+		o.ErrorPolicy = policy
+		o.DeadLetter = deadLetter
+	}
 }
 
-func NewDeserSource[T any](src ByteSource, deser DeserFunc[T]) DeserializationSource[T] {
-	return DeserializationSource[T]{
-		src:   src,
-		deser: deser,
+// NewDeserSource returns a source which receives messages from src and
+// deserializes them with deser.  If the options are invalid, Recv returns an
+// error describing why.
+func NewDeserSource[T any](src ByteSource, deser DeserFunc[T], opts ...DeserOption) DeserializationSource[T] {
+	var cfg DeserOpts
+	for _, o := range opts {
+		o(&cfg)
+	}
+	ds := DeserializationSource[T]{
+		src:         src,
+		deser:       deser,
+		errorPolicy: cfg.ErrorPolicy,
+		deadLetter:  cfg.DeadLetter,
 	}
+	if cfg.ErrorPolicy == DeadLetterOnError && cfg.DeadLetter == nil {
+		ds.err = errors.New("DeadLetter destination required for DeadLetterOnError policy")
+	}
+	return ds
 }
 
+// Recv receives a message from the wrapped source and deserializes it.  Messages
+// which fail to deserialize are handled according to the configured
+// ErrorPolicy.  Unless the policy is FailOnError, Recv moves on to the next
+// message instead of returning the error.
 func (ds DeserializationSource[T]) Recv(ctx context.Context) (Message[T], func(), error) {
-	msg, ack, err := ds.src.Recv(ctx)
-	if err != nil {
-		return Message[T]{}, ack, err
+	msg, ack, _, err := ds.recv(ctx, false)
+	return msg, ack, err
+}
+
+// RecvWithNack is like Recv, and passes through the nack function of the
+// wrapped source if it implements NackSource.
+func (ds DeserializationSource[T]) RecvWithNack(ctx context.Context) (Message[T], func(), NackFunc, error) {
+	return ds.recv(ctx, true)
+}
+
+func (ds DeserializationSource[T]) recv(ctx context.Context, withNack bool) (Message[T], func(), NackFunc, error) {
+	if ds.err != nil {
+		return Message[T]{}, nil, nil, ds.err
 	}
-	val, err := ds.deser(msg.Value)
+	ns, canNack := ds.src.(NackSource[[]byte])
+	for {
+		var (
+			msg  Message[[]byte]
+			ack  func()
+			nack NackFunc
+			err  error
+		)
+		if withNack && canNack {
+			msg, ack, nack, err = ns.RecvWithNack(ctx)
+		} else {
+			msg, ack, err = ds.src.Recv(ctx)
+		}
+		if err != nil {
+			return Message[T]{}, ack, nack, err
+		}
+		val, err := ds.deser(msg.Value)
 
-	ret := Message[T]{
-		Key:        msg.Key,
-		Value:      val,
-		Topic:      msg.Topic,
-		Attributes: msg.Attributes,
+		ret := withValue(msg, val)
+		if err != nil {
+			err = applyErrorPolicy(ctx, ds.errorPolicy, ds.deadLetter, "deserialize", msg, ack, err)
+			if err == nil {
+				continue
+			}
+		}
+		return ret, ack, nack, err
 	}
-	return ret, ack, err
 }
@@ -0,0 +1,314 @@
+// Package ackdebug provides a Source wrapper which tracks the lifecycle of
+// every ack it issues, to help find messages which are never acknowledged and
+// acks which are called more than once.  It adds overhead to every message, so
+// it's meant for debugging rather than for production use.
+package ackdebug
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/runreveal/kawa"
+)
+
+type Opts struct {
+	Deadline         time.Duration
+	Logger           *slog.Logger
+	PanicOnDoubleAck bool
+}
+
+// Deadline sets how long a message may go unacknowledged before it's reported
+// as leaked.  Defaults to 1 minute.
+func Deadline(d time.Duration) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Deadline = d
+	}
+}
+
+// Logger sets the logger leaks and double acks are reported to.  Defaults to
+// slog.Default().
+func Logger(l *slog.Logger) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Logger = l
+	}
+}
+
+// PanicOnDoubleAck makes a second call to an ack panic instead of only being
+// reported.
+func PanicOnDoubleAck(b bool) func(*Opts) {
+	return func(opts *Opts) {
+		opts.PanicOnDoubleAck = b
+	}
+}
+
+// Stats are counts of the acks issued by a Source.
+type Stats struct {
+	// Issued is the number of messages received.
+	Issued uint64
+	// Acked is the number of messages acknowledged.
+	Acked uint64
+	// Nacked is the number of messages negatively acknowledged.
+	Nacked uint64
+	// Outstanding is the number of messages neither acked nor nacked yet.
+	Outstanding int
+	// Leaked is the number of outstanding messages older than the deadline.
+	Leaked int
+	// DoubleAcks is the number of times an ack was called again after the
+	// message was already acked or nacked.
+	DoubleAcks uint64
+}
+
+// Leak describes a message which hasn't been acknowledged within the deadline.
+type Leak struct {
+	Key        string
+	Topic      string
+	ReceivedAt time.Time
+	// Caller is the stack of the call to Recv which received the message.
+	Caller string
+}
+
+type issued struct {
+	key      string
+	topic    string
+	at       time.Time
+	pcs      []uintptr
+	reported bool
+}
+
+// Source wraps a kawa.Source and tracks the acks of the messages received from
+// it.  Leaks are checked for on demand by Leaks and Stats, and reported to the
+// logger periodically while Run is running.
+type Source[T any] struct {
+	src      kawa.Source[T]
+	deadline time.Duration
+	logger   *slog.Logger
+	panicky  bool
+
+	issuedN    atomic.Uint64
+	acked      atomic.Uint64
+	nacked     atomic.Uint64
+	doubleAcks atomic.Uint64
+
+	mu          sync.Mutex
+	nextID      uint64
+	outstanding map[uint64]*issued
+}
+
+var _ kawa.NackSource[any] = (*Source[any])(nil)
+
+func New[T any](src kawa.Source[T], opts ...func(*Opts)) *Source[T] {
+	cfg := Opts{
+		Deadline: time.Minute,
+		Logger:   slog.Default(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &Source[T]{
+		src:         src,
+		deadline:    cfg.Deadline,
+		logger:      cfg.Logger,
+		panicky:     cfg.PanicOnDoubleAck,
+		outstanding: make(map[uint64]*issued),
+	}
+}
+
+func (s *Source[T]) Recv(ctx context.Context) (kawa.Message[T], func(), error) {
+	msg, ack, err := s.src.Recv(ctx)
+	if err != nil {
+		return msg, ack, err
+	}
+	ack, _ = s.track(msg, ack, nil)
+	return msg, ack, nil
+}
+
+// RecvWithNack satisfies kawa.NackSource.  The nack func is nil unless the
+// wrapped source implements kawa.NackSource.
+func (s *Source[T]) RecvWithNack(ctx context.Context) (kawa.Message[T], func(), kawa.NackFunc, error) {
+	var (
+		msg  kawa.Message[T]
+		ack  func()
+		nack kawa.NackFunc
+		err  error
+	)
+	if ns, ok := s.src.(kawa.NackSource[T]); ok {
+		msg, ack, nack, err = ns.RecvWithNack(ctx)
+	} else {
+		msg, ack, err = s.src.Recv(ctx)
+	}
+	if err != nil {
+		return msg, ack, nack, err
+	}
+	ack, nack = s.track(msg, ack, nack)
+	return msg, ack, nack, nil
+}
+
+func (s *Source[T]) track(msg kawa.Message[T], ack func(), nack kawa.NackFunc) (func(), kawa.NackFunc) {
+	pcs := make([]uintptr, 16)
+	// skip runtime.Callers, track and the Recv method
+	pcs = pcs[:runtime.Callers(3, pcs)]
+
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	s.outstanding[id] = &issued{
+		key:   msg.Key,
+		topic: msg.Topic,
+		at:    time.Now(),
+		pcs:   pcs,
+	}
+	s.mu.Unlock()
+	s.issuedN.Add(1)
+
+	var settled atomic.Bool
+	trackedAck := func() {
+		if !settled.CompareAndSwap(false, true) {
+			s.doubleAck(msg)
+			return
+		}
+		s.settle(id)
+		s.acked.Add(1)
+		kawa.Ack(ack)
+	}
+	if nack == nil {
+		return trackedAck, nil
+	}
+	return trackedAck, func(reason error, requeueAfter time.Duration) {
+		if !settled.CompareAndSwap(false, true) {
+			s.doubleAck(msg)
+			return
+		}
+		s.settle(id)
+		s.nacked.Add(1)
+		nack(reason, requeueAfter)
+	}
+}
+
+func (s *Source[T]) settle(id uint64) {
+	s.mu.Lock()
+	is := *s.outstanding[id]
+	delete(s.outstanding, id)
+	s.mu.Unlock()
+	if is.reported {
+		s.logger.Warn("ackdebug: leaked message acknowledged late",
+			"key", is.key,
+			"topic", is.topic,
+			"age", time.Since(is.at),
+		)
+	}
+}
+
+func (s *Source[T]) doubleAck(msg kawa.Message[T]) {
+	s.doubleAcks.Add(1)
+	caller := stack(2)
+	s.logger.Error("ackdebug: message acknowledged more than once",
+		"key", msg.Key,
+		"topic", msg.Topic,
+		"caller", caller,
+	)
+	if s.panicky {
+		panic(fmt.Sprintf("ackdebug: message acknowledged more than once (key %q, topic %q)", msg.Key, msg.Topic))
+	}
+}
+
+// Leaks returns the messages which have been outstanding for longer than the
+// deadline, oldest first.
+func (s *Source[T]) Leaks() []Leak {
+	var leaks []Leak
+	for _, is := range s.overdue(false) {
+		leaks = append(leaks, Leak{
+			Key:        is.key,
+			Topic:      is.topic,
+			ReceivedAt: is.at,
+			Caller:     format(is.pcs),
+		})
+	}
+	return leaks
+}
+
+// overdue returns the outstanding messages older than the deadline, oldest
+// first.  If report is set, only those not reported before are returned, and
+// they're marked as reported.
+func (s *Source[T]) overdue(report bool) []issued {
+	cutoff := time.Now().Add(-s.deadline)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []issued
+	for _, is := range s.outstanding {
+		if !is.at.Before(cutoff) || (report && is.reported) {
+			continue
+		}
+		if report {
+			is.reported = true
+		}
+		res = append(res, *is)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].at.Before(res[j].at) })
+	return res
+}
+
+func (s *Source[T]) Stats() Stats {
+	s.mu.Lock()
+	outstanding := len(s.outstanding)
+	s.mu.Unlock()
+	return Stats{
+		Issued:      s.issuedN.Load(),
+		Acked:       s.acked.Load(),
+		Nacked:      s.nacked.Load(),
+		Outstanding: outstanding,
+		Leaked:      len(s.overdue(false)),
+		DoubleAcks:  s.doubleAcks.Load(),
+	}
+}
+
+// Run periodically reports leaked messages to the logger until ctx is done.
+// Each leaked message is reported once.
+func (s *Source[T]) Run(ctx context.Context) error {
+	interval := s.deadline / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		for _, is := range s.overdue(true) {
+			s.logger.Warn("ackdebug: message not acknowledged within deadline",
+				"key", is.key,
+				"topic", is.topic,
+				"age", time.Since(is.at),
+				"caller", format(is.pcs),
+			)
+		}
+	}
+}
+
+// stack returns the formatted stack of the caller, skipping skip frames.
+func stack(skip int) string {
+	pcs := make([]uintptr, 16)
+	return format(pcs[:runtime.Callers(skip+2, pcs)])
+}
+
+func format(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package ackdebug
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	var n int
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		n++
+		return kawa.Message[string]{Key: "k", Topic: "t"}, func() { n += 100 }, nil
+	})
+	s := New[string](src,
+		Deadline(10*time.Millisecond),
+		Logger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx := context.Background()
+	_, ack1, err := s.Recv(ctx)
+	require.NoError(t, err)
+	_, _, err = s.Recv(ctx)
+	require.NoError(t, err)
+
+	ack1()
+	ack1()
+	assert.Equal(t, 102, n, "underlying ack should only be called once")
+
+	time.Sleep(20 * time.Millisecond)
+	leaks := s.Leaks()
+	require.Len(t, leaks, 1)
+	assert.Equal(t, "k", leaks[0].Key)
+	assert.Equal(t, "t", leaks[0].Topic)
+	assert.Contains(t, leaks[0].Caller, "TestSource")
+
+	assert.Equal(t, Stats{
+		Issued:      2,
+		Acked:       1,
+		Outstanding: 1,
+		Leaked:      1,
+		DoubleAcks:  1,
+	}, s.Stats())
+}
+
+func TestPanicOnDoubleAck(t *testing.T) {
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		return kawa.Message[string]{}, nil, nil
+	})
+	s := New[string](src,
+		PanicOnDoubleAck(true),
+		Logger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	_, ack, err := s.Recv(context.Background())
+	require.NoError(t, err)
+	ack()
+	assert.Panics(t, ack)
+}
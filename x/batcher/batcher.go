@@ -11,6 +11,10 @@ import (
 
 	"github.com/runreveal/kawa"
 	"github.com/segmentio/ksuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
 )
 
 // ErrDontAck should be returned by ErrorHandlers when they wish to
@@ -48,8 +52,8 @@ func (ef ErrorFunc[T]) HandleError(c context.Context, err error, msgs []kawa.Mes
 }
 
 // Destination is a batching destination that will buffer messages until the
-// FlushLength limit is reached or the FlushFrequency timer fires, whichever
-// comes first.
+// FlushLength or FlushBytes limit is reached or the FlushFrequency timer fires,
+// whichever comes first.
 //
 // `Destination.Run` must be called after calling `New` before events will be
 // processed in this destination. Not calling `Run` will likely end in a
@@ -59,17 +63,30 @@ type Destination[T any] struct {
 	flusher         Flusher[T]
 	flushq          chan struct{}
 	flushlen        int
+	flushBytes      int
 	flushfreq       time.Duration
 	flushcan        map[string]context.CancelFunc
 	flushTimeout    time.Duration
 	stopTimeout     time.Duration
 	watchdogTimeout time.Duration
+	flushOnStop     bool
+	flushRetry      *kawa.RetryPolicy
 
 	errorHandler ErrorHandler[T]
 	flusherr     chan error
+	metrics      *batchMetrics
+	tracer       trace.Tracer
 
 	messages chan msgAck[T]
 	buf      []msgAck[T]
+	bufBytes int
+
+	sizer       func(T) int
+	maxBuffered int64
+	buffered    *semaphore.Weighted
+	// flushNow asks Run to flush early because a Send is waiting for room
+	// under MaxBufferedBytes.
+	flushNow chan struct{}
 
 	count   int
 	running bool
@@ -79,12 +96,44 @@ type Destination[T any] struct {
 type OptFunc func(*Opts)
 
 type Opts struct {
+	Name             string
+	Metrics          bool
+	Tracing          bool
 	FlushLength      int
 	FlushFrequency   time.Duration
 	FlushTimeout     time.Duration
 	FlushParallelism int
 	StopTimeout      time.Duration
 	WatchdogTimeout  time.Duration
+	FlushOnStop      bool
+	FlushRetry       *kawa.RetryPolicy
+	FlushBytes       int
+	MaxBufferedBytes int
+}
+
+// Name sets the name of the batcher, which is used to identify it in metrics.
+// Defaults to "default".
+func Name(name string) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Name = name
+	}
+}
+
+// Metrics enables recording of OpenTelemetry metrics using the global
+// MeterProvider.  Each instrument is tagged with the batcher's Name.
+func Metrics(b bool) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Metrics = b
+	}
+}
+
+// Tracing enables OpenTelemetry tracing using the global TracerProvider.  Each
+// flush is recorded as a span linked to the span contexts carried by the
+// flushed messages' Attributes (see kawa.WithSpanContext).
+func Tracing(b bool) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Tracing = b
+	}
 }
 
 func FlushFrequency(d time.Duration) func(*Opts) {
@@ -99,6 +148,29 @@ func FlushLength(size int) func(*Opts) {
 	}
 }
 
+// FlushBytes flushes the buffer once the total size of the buffered messages
+// reaches n bytes, as measured by the sizer (see NewSizedDestination).  A message which would take the
+// buffer over n causes the buffer to be flushed before it's added, so batches
+// only exceed n when a single message does.
+func FlushBytes(n int) func(*Opts) {
+	return func(opts *Opts) {
+		opts.FlushBytes = n
+	}
+}
+
+// MaxBufferedBytes bounds the total size of the messages held by the batcher,
+// as measured by the sizer, including those being flushed.  Send blocks while
+// the limit is reached, until flushes complete, applying backpressure to the
+// caller.  A blocked Send flushes the buffer without waiting for the
+// FlushLength, FlushBytes or FlushFrequency limits.  A single message larger
+// than n is admitted once nothing else is held.  n must be at least
+// FlushBytes, if set.
+func MaxBufferedBytes(n int) func(*Opts) {
+	return func(opts *Opts) {
+		opts.MaxBufferedBytes = n
+	}
+}
+
 func FlushParallelism(n int) func(*Opts) {
 	return func(opts *Opts) {
 		opts.FlushParallelism = n
@@ -123,6 +195,24 @@ func StopTimeout(d time.Duration) func(*Opts) {
 	}
 }
 
+// FlushOnStop makes the batcher flush any buffered messages when the context
+// passed to Run is done, rather than dropping them.  The final flush is
+// subject to StopTimeout like any other flush in flight at shutdown.
+func FlushOnStop(b bool) func(*Opts) {
+	return func(opts *Opts) {
+		opts.FlushOnStop = b
+	}
+}
+
+// FlushRetry retries flushes which fail with errors the policy classifies as
+// retryable (by default, those marked with kawa.Retryable) before passing the
+// error to the ErrorHandler.  Retries are subject to FlushTimeout.
+func FlushRetry(rp kawa.RetryPolicy) func(*Opts) {
+	return func(opts *Opts) {
+		opts.FlushRetry = &rp
+	}
+}
+
 func DiscardHandler[T any]() ErrorHandler[T] {
 	return ErrorFunc[T](func(context.Context, error, []kawa.Message[T]) error { return nil })
 }
@@ -131,9 +221,26 @@ func Raise[T any]() ErrorHandler[T] {
 	return ErrorFunc[T](func(_ context.Context, err error, _ []kawa.Message[T]) error { return err })
 }
 
-// NewDestination instantiates a new batcher.
+// NewDestination instantiates a new batcher.  The size of messages for the
+// FlushBytes and MaxBufferedBytes options is measured with len, which requires
+// T to be []byte or string; use NewSizedDestination for other types.
+// NewDestination panics if the options are invalid.
 func NewDestination[T any](f Flusher[T], e ErrorHandler[T], opts ...OptFunc) *Destination[T] {
+	return newDestination(f, e, defaultSizer[T](), opts)
+}
+
+// NewSizedDestination is like NewDestination, and measures the size of
+// messages for the FlushBytes and MaxBufferedBytes options with sizer.
+func NewSizedDestination[T any](f Flusher[T], e ErrorHandler[T], sizer func(T) int, opts ...OptFunc) *Destination[T] {
+	if sizer == nil {
+		panic("sizer must not be nil")
+	}
+	return newDestination(f, e, sizer, opts)
+}
+
+func newDestination[T any](f Flusher[T], e ErrorHandler[T], sizer func(T) int, opts []OptFunc) *Destination[T] {
 	cfg := Opts{
+		Name:             "default",
 		FlushLength:      100,
 		FlushFrequency:   1 * time.Second,
 		FlushParallelism: 2,
@@ -160,6 +267,12 @@ func NewDestination[T any](f Flusher[T], e ErrorHandler[T], opts ...OptFunc) *De
 	if cfg.FlushTimeout < 0 {
 		cfg.FlushTimeout = 0
 	}
+	if (cfg.FlushBytes > 0 || cfg.MaxBufferedBytes > 0) && sizer == nil {
+		panic("NewSizedDestination required for FlushBytes and MaxBufferedBytes with values other than []byte or string")
+	}
+	if cfg.MaxBufferedBytes > 0 && cfg.MaxBufferedBytes < cfg.FlushBytes {
+		panic("MaxBufferedBytes must be greater than or equal to FlushBytes")
+	}
 
 	d := &Destination[T]{
 		flushlen:        cfg.FlushLength,
@@ -170,37 +283,101 @@ func NewDestination[T any](f Flusher[T], e ErrorHandler[T], opts ...OptFunc) *De
 		flushTimeout:    cfg.FlushTimeout,
 		stopTimeout:     cfg.StopTimeout,
 		watchdogTimeout: cfg.WatchdogTimeout,
+		flushOnStop:     cfg.FlushOnStop,
+		flushRetry:      cfg.FlushRetry,
 
 		errorHandler: e,
 		flusherr:     make(chan error, cfg.FlushParallelism),
+		metrics:      newBatchMetrics(cfg.Name, cfg.Metrics),
+		tracer:       trace.NewNoopTracerProvider().Tracer("kawa/batcher"),
 
 		messages: make(chan msgAck[T]),
 	}
 
+	if cfg.FlushBytes > 0 {
+		d.flushBytes = cfg.FlushBytes
+	}
+	if cfg.FlushBytes > 0 || cfg.MaxBufferedBytes > 0 {
+		d.sizer = sizer
+	}
+	if cfg.MaxBufferedBytes > 0 {
+		d.maxBuffered = int64(cfg.MaxBufferedBytes)
+		d.buffered = semaphore.NewWeighted(d.maxBuffered)
+		d.flushNow = make(chan struct{}, 1)
+	}
+
+	if cfg.Tracing {
+		d.tracer = otel.Tracer("kawa/batcher")
+	}
+
 	return d
 }
 
+// defaultSizer returns len for []byte and string values, and nil otherwise.
+func defaultSizer[T any]() func(T) int {
+	switch any(*new(T)).(type) {
+	case []byte:
+		return func(v T) int { return len(any(v).([]byte)) }
+	case string:
+		return func(v T) int { return len(any(v).(string)) }
+	}
+	return nil
+}
+
 type msgAck[T any] struct {
-	msg kawa.Message[T]
-	ack func()
+	msg  kawa.Message[T]
+	ack  func()
+	nack func(error)
+	// size is the size of msg measured by the sizer, if any.
+	size int
+}
+
+// weight returns the number of bytes of the MaxBufferedBytes limit held by a
+// message of the given size.
+func (d *Destination[T]) weight(size int) int64 {
+	return min(int64(size), d.maxBuffered)
 }
 
 // Send satisfies the kawa.Destination interface and accepts messages to be
-// buffered for flushing after the FlushLength limit is reached or the
-// FlushFrequency timer fires, whichever comes first.
+// buffered for flushing after the FlushLength or FlushBytes limit is reached or
+// the FlushFrequency timer fires, whichever comes first.  With
+// MaxBufferedBytes, Send blocks until there's room for each message in turn.
 //
 // Messages will not be acknowledged until they have been flushed successfully.
+// If ctx carries a nack func (see kawa.ContextWithNack), it's called when a
+// flush of the messages fails and the ErrorHandler returns ErrDontAck, so that
+// the source redelivers them promptly.  Other errors stop the batcher, so the
+// messages are left for the source to redeliver once it's restarted.
 func (d *Destination[T]) Send(ctx context.Context, ack func(), msgs ...kawa.Message[T]) error {
 	if len(msgs) < 1 {
 		return nil
 	}
 
 	callMe := ackFn(ack, len(msgs))
+	nackMe := nackOnce(kawa.NackFromContext(ctx))
 
 	for _, m := range msgs {
+		ma := msgAck[T]{msg: m, ack: callMe, nack: nackMe}
+		if d.sizer != nil {
+			ma.size = d.sizer(m.Value)
+		}
+		if d.buffered != nil && !d.buffered.TryAcquire(d.weight(ma.size)) {
+			// Make room by flushing what's buffered, rather than waiting
+			// for it to reach a flush limit.
+			select {
+			case d.flushNow <- struct{}{}:
+			default:
+			}
+			if err := d.buffered.Acquire(ctx, d.weight(ma.size)); err != nil {
+				return err
+			}
+		}
 		select {
-		case d.messages <- msgAck[T]{msg: m, ack: callMe}: // Here
+		case d.messages <- ma: // Here
 		case <-ctx.Done():
+			if d.buffered != nil {
+				d.buffered.Release(d.weight(ma.size))
+			}
 			// TODO: one more flush?
 			return ctx.Err()
 		}
@@ -212,12 +389,17 @@ func (d *Destination[T]) Send(ctx context.Context, ack func(), msgs ...kawa.Mess
 // Run starts the batching destination.  It must be called before messages will
 // be processed and written to the underlying Flusher.
 // Run will block until the context is canceled.
-// Upon cancellation, Run will flush any remaining messages in the buffer and
-// return any flush errors that occur
+// Upon cancellation, Run will flush any remaining messages in the buffer if
+// FlushOnStop is set and return any flush errors that occur.  Otherwise, and
+// whenever Run returns early with an error, buffered messages are dropped
+// without being acknowledged.
 func (d *Destination[T]) Run(ctx context.Context) error {
 	var epoch uint64
 	epochC := make(chan uint64)
 	setTimer := true
+	// done stops flush timers which fire after Run has returned.
+	done := make(chan struct{})
+	defer close(done)
 
 	d.syncMu.Lock()
 	if d.running {
@@ -226,6 +408,15 @@ func (d *Destination[T]) Run(ctx context.Context) error {
 		d.running = true
 	}
 	d.syncMu.Unlock()
+	defer func() {
+		// Messages left in the buffer are dropped unacknowledged for the
+		// source to redeliver, so they mustn't hold up Send.
+		d.dropBuffer()
+		// Allow Run to be called again, e.g. by a supervisor restarting it.
+		d.syncMu.Lock()
+		d.running = false
+		d.syncMu.Unlock()
+	}()
 
 	var wdChan <-chan time.Time
 	var wdTimer *time.Timer
@@ -234,6 +425,10 @@ func (d *Destination[T]) Run(ctx context.Context) error {
 		wdChan = wdTimer.C
 	}
 
+	// pressure is set when a Send is waiting for room but there was nothing
+	// to flush yet, so the next message is flushed straight away.
+	var pressure bool
+
 	var err error
 loop:
 	for {
@@ -243,11 +438,20 @@ loop:
 
 		case msg := <-d.messages: // Here
 			d.count++
+			if d.flushBytes > 0 && len(d.buf) > 0 && d.bufBytes+msg.size > d.flushBytes {
+				// Flush first so the batch stays within FlushBytes.
+				epoch++
+				d.flush(ctx)
+				setTimer = true
+			}
 			if setTimer {
 				// copy the epoch to send on the chan after the timer fires
 				epc := epoch
 				time.AfterFunc(d.flushfreq, func() {
-					epochC <- epc // Here
+					select {
+					case epochC <- epc: // Here
+					case <-done:
+					}
 				})
 
 				if wdTimer != nil {
@@ -260,11 +464,24 @@ loop:
 				setTimer = false
 			}
 			d.buf = append(d.buf, msg)
-			if len(d.buf) >= d.flushlen {
+			d.bufBytes += msg.size
+			d.metrics.queueDepth.Add(ctx, 1, d.metrics.attrs)
+			d.metrics.queueBytes.Add(ctx, int64(msg.size), d.metrics.attrs)
+			if pressure || len(d.buf) >= d.flushlen || (d.flushBytes > 0 && d.bufBytes >= d.flushBytes) {
+				pressure = false
 				epoch++
 				d.flush(ctx)
 				setTimer = true
 			}
+		case <-d.flushNow:
+			if len(d.buf) == 0 {
+				pressure = true
+				continue
+			}
+			pressure = false
+			epoch++
+			d.flush(ctx)
+			setTimer = true
 		case tEpoch := <-epochC:
 			// if we haven't flushed yet this epoch, then flush, otherwise ignore
 			if tEpoch == epoch {
@@ -273,7 +490,10 @@ loop:
 				setTimer = true
 			}
 		case <-ctx.Done():
-			// on shutdown, don't attempt final flush even if buffer is not empty
+			// on shutdown, don't attempt final flush unless configured to
+			if d.flushOnStop && len(d.buf) > 0 {
+				d.finalFlush()
+			}
 			break loop
 		case err = <-d.flusherr:
 			break loop
@@ -305,6 +525,32 @@ loop:
 
 var errDeadlock = errors.New("batcher: flushes timed out")
 
+// finalFlush flushes the remaining buffer once Run's context is done.  Waiting
+// for a flush slot is bounded by the stop timeout rather than Run's context.
+func (d *Destination[T]) finalFlush() {
+	ctx, cancel := context.WithTimeout(context.Background(), d.stopTimeout)
+	defer cancel()
+	d.flush(ctx)
+	if len(d.buf) > 0 {
+		slog.Warn("batcher: no flush slot available for final flush. dropping messages.", "len", len(d.buf))
+		d.dropBuffer()
+	}
+}
+
+// dropBuffer discards the buffered messages without acknowledging them, and
+// frees the room they held under the MaxBufferedBytes limit.
+func (d *Destination[T]) dropBuffer() {
+	if len(d.buf) == 0 {
+		return
+	}
+	ctx := context.Background()
+	d.metrics.queueDepth.Add(ctx, -int64(len(d.buf)), d.metrics.attrs)
+	d.metrics.queueBytes.Add(ctx, -int64(d.bufBytes), d.metrics.attrs)
+	d.release(d.buf)
+	d.buf = d.buf[:0]
+	d.bufBytes = 0
+}
+
 func (d *Destination[T]) flush(ctx context.Context) {
 	// We make a new context here so that we can cancel the flush if the parent
 	// context is canceled. It's important to use context.Background() here because
@@ -329,12 +575,16 @@ func (d *Destination[T]) flush(ctx context.Context) {
 
 	// Have to make a copy so these don't get overwritten
 	msgs, acks := make([]kawa.Message[T], len(d.buf)), make([]func(), len(d.buf))
+	nacks := make([]func(error), len(d.buf))
 	for i, m := range d.buf {
 		msgs[i] = m.msg
 		acks[i] = m.ack
+		nacks[i] = m.nack
 	}
-	go func(id string, msgs []kawa.Message[T], acks []func()) {
-		d.doflush(flctx, msgs, acks)
+	held := append([]msgAck[T](nil), d.buf...)
+	go func(id string, msgs []kawa.Message[T], acks []func(), nacks []func(error)) {
+		d.doflush(flctx, msgs, acks, nacks)
+		d.release(held)
 		// clear flush slot
 		<-d.flushq
 		// clear cancel
@@ -343,20 +593,59 @@ func (d *Destination[T]) flush(ctx context.Context) {
 		delete(d.flushcan, id)
 		d.syncMu.Unlock()
 		cncl()
-	}(id, msgs, acks)
+	}(id, msgs, acks, nacks)
 	// Clear the buffer for the next batch
+	d.metrics.queueDepth.Add(ctx, -int64(len(d.buf)), d.metrics.attrs)
+	d.metrics.queueBytes.Add(ctx, -int64(d.bufBytes), d.metrics.attrs)
 	d.buf = d.buf[:0]
+	d.bufBytes = 0
 }
 
-func (d *Destination[T]) doflush(ctx context.Context, msgs []kawa.Message[T], acks []func()) {
+// release frees the room held by msgs under the MaxBufferedBytes limit.
+func (d *Destination[T]) release(msgs []msgAck[T]) {
+	if d.buffered == nil {
+		return
+	}
+	var n int64
+	for _, m := range msgs {
+		n += d.weight(m.size)
+	}
+	d.buffered.Release(n)
+}
+
+func (d *Destination[T]) doflush(ctx context.Context, msgs []kawa.Message[T], acks []func(), nacks []func(error)) {
 	if d.flushTimeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, d.flushTimeout)
 		defer cancel()
 	}
 
-	err := d.flusher.Flush(ctx, msgs)
+	// Flushes happen asynchronously from the sends which produced the messages,
+	// so link the flush to each of the messages' traces.
+	var links []trace.Link
+	for _, m := range msgs {
+		if sc := kawa.SpanContextFromAttributes(m.Attributes); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := d.tracer.Start(ctx, "kawa.batcher.flush", trace.WithLinks(links...))
+	defer span.End()
+
+	start := time.Now()
+	var err error
+	if d.flushRetry != nil {
+		err = d.flushRetry.Do(ctx, func(c context.Context) error {
+			return d.flusher.Flush(c, msgs)
+		})
+	} else {
+		err = d.flusher.Flush(ctx, msgs)
+	}
+	d.metrics.batchSize.Record(ctx, int64(len(msgs)), d.metrics.attrs)
+	d.metrics.flushDuration.Record(ctx, time.Since(start).Seconds(), d.metrics.attrs)
 	if err != nil {
+		d.metrics.flushErrors.Add(ctx, 1, d.metrics.attrs)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		slog.Debug("flush err", "error", err)
 		err := d.errorHandler.HandleError(ctx, err, msgs)
 		if err != nil {
@@ -364,6 +653,14 @@ func (d *Destination[T]) doflush(ctx context.Context, msgs []kawa.Message[T], ac
 			// batcher to continue running, but to skip acknowledging the delivery
 			// of the affected messages
 			if errors.Is(err, ErrDontAck) {
+				// Ask for the affected messages to be redelivered, if the
+				// source supports it, rather than waiting for them to time
+				// out.
+				for _, nack := range nacks {
+					if nack != nil {
+						nack(err)
+					}
+				}
 				return
 			}
 
@@ -381,6 +678,19 @@ func (d *Destination[T]) doflush(ctx context.Context, msgs []kawa.Message[T], ac
 	}
 }
 
+// nackOnce returns a func which calls nack the first time it's called, as all
+// of the messages passed to a single Send share one nack func.  Returns nil if
+// nack is nil.
+func nackOnce(nack kawa.NackFunc) func(error) {
+	if nack == nil {
+		return nil
+	}
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { nack(err, 0) })
+	}
+}
+
 // only call ack on last message acknowledgement
 func ackFn(ack func(), num int) func() {
 	ackChu := make(chan struct{}, num-1)
@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/runreveal/kawa"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAckChu(t *testing.T) {
@@ -378,3 +379,253 @@ func TestBatcherErrors(t *testing.T) {
 		assert.Equal(t, 0, ackCount)
 	})
 }
+
+func TestBatcherFlushOnStop(t *testing.T) {
+	flushed := make(chan []kawa.Message[string], 1)
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		flushed <- msgs
+		return nil
+	}
+
+	bat := NewDestination[string](
+		FlushFunc[string](ff),
+		Raise[string](),
+		FlushLength(10),
+		FlushFrequency(time.Hour),
+		FlushOnStop(true),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func(c context.Context, ec chan error) {
+		ec <- bat.Run(c)
+	}(ctx, errc)
+
+	done := make(chan struct{})
+	err := bat.Send(ctx, func() { close(done) }, kawa.Message[string]{Value: "hi"}, kawa.Message[string]{Value: "hello"})
+	assert.NoError(t, err)
+	cancel()
+
+	assert.NoError(t, <-errc)
+	select {
+	case msgs := <-flushed:
+		assert.Len(t, msgs, 2)
+	default:
+		t.Fatal("buffered messages should have been flushed on stop")
+	}
+	<-done
+}
+
+func TestBatcherNackOnDontAck(t *testing.T) {
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		return errors.New("flush failed")
+	}
+	eh := ErrorFunc[string](func(context.Context, error, []kawa.Message[string]) error {
+		return ErrDontAck
+	})
+
+	bat := NewDestination[string](FlushFunc[string](ff), eh, FlushLength(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func(c context.Context, ec chan error) {
+		ec <- bat.Run(c)
+	}(ctx, errc)
+
+	nacked := make(chan error, 2)
+	nctx := kawa.ContextWithNack(ctx, func(reason error, _ time.Duration) {
+		nacked <- reason
+	})
+	err := bat.Send(nctx, func() { t.Error("messages should not be acked") },
+		kawa.Message[string]{Value: "hi"}, kawa.Message[string]{Value: "hello"})
+	assert.NoError(t, err)
+
+	select {
+	case reason := <-nacked:
+		assert.ErrorIs(t, reason, ErrDontAck)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for nack")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+	assert.Empty(t, nacked, "messages from one Send should be nacked once")
+}
+
+func TestBatcherRunAgain(t *testing.T) {
+	flushed := make(chan string, 2)
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		for _, m := range msgs {
+			flushed <- m.Value
+		}
+		return nil
+	}
+	bat := NewDestination[string](FlushFunc[string](ff), Raise[string](), FlushLength(1))
+
+	for _, v := range []string{"first", "second"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error)
+		go func() { errc <- bat.Run(ctx) }()
+		assert.NoError(t, bat.Send(ctx, nil, kawa.Message[string]{Value: v}))
+		assert.Equal(t, v, <-flushed)
+		cancel()
+		assert.NoError(t, <-errc)
+	}
+}
+
+func TestBatcherFlushBytes(t *testing.T) {
+	batches := make(chan []string, 10)
+	var ff = func(c context.Context, msgs []kawa.Message[[]byte]) error {
+		var vs []string
+		for _, m := range msgs {
+			vs = append(vs, string(m.Value))
+		}
+		batches <- vs
+		return nil
+	}
+	bat := NewDestination[[]byte](FlushFunc[[]byte](ff), Raise[[]byte](),
+		FlushLength(100), FlushFrequency(time.Hour), FlushBytes(10), FlushParallelism(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+
+	for _, v := range []string{"aaaa", "bbbb", "cccc", "dddddddddddd", "ee", "ffffffff"} {
+		require.NoError(t, bat.Send(ctx, nil, kawa.Message[[]byte]{Value: []byte(v)}))
+	}
+	// "cccc" would take the first batch over 10 bytes, the oversized message
+	// gets a batch of its own, and "ffffffff" fills the next batch exactly.
+	assert.Equal(t, []string{"aaaa", "bbbb"}, <-batches)
+	assert.Equal(t, []string{"cccc"}, <-batches)
+	assert.Equal(t, []string{"dddddddddddd"}, <-batches)
+	assert.Equal(t, []string{"ee", "ffffffff"}, <-batches)
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestBatcherMaxBufferedBytes(t *testing.T) {
+	release := make(chan struct{})
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		<-release
+		return nil
+	}
+	bat := NewSizedDestination[string](FlushFunc[string](ff), Raise[string](),
+		func(s string) int { return len(s) }, FlushLength(1), MaxBufferedBytes(8))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+
+	require.NoError(t, bat.Send(ctx, nil, kawa.Message[string]{Value: "12345"}))
+
+	// The second message doesn't fit until the first has been flushed.
+	sent := make(chan error, 1)
+	go func() { sent <- bat.Send(ctx, nil, kawa.Message[string]{Value: "12345"}) }()
+	select {
+	case <-sent:
+		t.Fatal("Send should block while the buffer is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tctx, tcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer tcancel()
+	assert.ErrorIs(t, bat.Send(tctx, nil, kawa.Message[string]{Value: "1234"}), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, <-sent)
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestBatcherMaxBufferedBytesFlushesEarly(t *testing.T) {
+	flushed := make(chan int, 3)
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		flushed <- len(msgs)
+		return nil
+	}
+	// Neither FlushLength nor FlushFrequency is reached, so only a Send
+	// waiting for room triggers a flush.
+	bat := NewDestination[string](FlushFunc[string](ff), Raise[string](),
+		FlushLength(100), FlushFrequency(time.Hour), MaxBufferedBytes(8))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+
+	for i := 0; i < 3; i++ {
+		sctx, scancel := context.WithTimeout(ctx, time.Second)
+		require.NoError(t, bat.Send(sctx, nil, kawa.Message[string]{Value: "1234"}))
+		scancel()
+	}
+	assert.Equal(t, 2, <-flushed)
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestBatcherMaxBufferedBytesReleasedOnStop(t *testing.T) {
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		return nil
+	}
+	bat := NewDestination[string](FlushFunc[string](ff), Raise[string](),
+		FlushLength(100), FlushFrequency(time.Hour), MaxBufferedBytes(8))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+	require.NoError(t, bat.Send(ctx, nil, kawa.Message[string]{Value: "12345678"}))
+	cancel()
+	require.NoError(t, <-errc)
+
+	// The message dropped when Run returned no longer holds room.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { errc <- bat.Run(ctx) }()
+	sctx, scancel := context.WithTimeout(ctx, time.Second)
+	defer scancel()
+	assert.NoError(t, bat.Send(sctx, nil, kawa.Message[string]{Value: "12345678"}))
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestBatcherSizerRequired(t *testing.T) {
+	ff := FlushFunc[int](func(context.Context, []kawa.Message[int]) error { return nil })
+	sizer := func(int) int { return 8 }
+	assert.Panics(t, func() { NewDestination[int](ff, Raise[int](), FlushBytes(10)) })
+	assert.Panics(t, func() { NewSizedDestination[int](ff, Raise[int](), nil, FlushBytes(10)) })
+	assert.NotPanics(t, func() { NewSizedDestination[int](ff, Raise[int](), sizer, FlushBytes(10)) })
+	assert.Panics(t, func() {
+		NewSizedDestination[int](ff, Raise[int](), sizer, FlushBytes(10), MaxBufferedBytes(5))
+	})
+}
+
+func TestBatcherFlushRetry(t *testing.T) {
+	var calls int
+	acked := make(chan struct{})
+	var ff = func(c context.Context, msgs []kawa.Message[string]) error {
+		calls++
+		if calls < 3 {
+			return kawa.Retryable(errors.New("transient"))
+		}
+		return nil
+	}
+	bat := NewDestination[string](FlushFunc[string](ff), Raise[string](), FlushLength(1),
+		FlushRetry(kawa.RetryPolicy{InitialBackoff: time.Millisecond}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+
+	require.NoError(t, bat.Send(ctx, func() { close(acked) }, kawa.Message[string]{Value: "hi"}))
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("message wasn't acknowledged")
+	}
+	cancel()
+	assert.NoError(t, <-errc)
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// batchMetrics holds the OpenTelemetry instruments recorded by a batching
+// Destination.  When metrics are disabled, the instruments are no-ops.
+type batchMetrics struct {
+	attrs metric.MeasurementOption
+
+	batchSize     metric.Int64Histogram
+	flushDuration metric.Float64Histogram
+	flushErrors   metric.Int64Counter
+	queueDepth    metric.Int64UpDownCounter
+	queueBytes    metric.Int64UpDownCounter
+}
+
+// newBatchMetrics returns the batcher's instruments, using the global
+// MeterProvider if enabled.  Metrics are disabled if the instruments can't be
+// created, rather than failing the batcher.
+func newBatchMetrics(name string, enabled bool) *batchMetrics {
+	noopMeter := noop.NewMeterProvider().Meter("kawa/batcher")
+	if !enabled {
+		bm, _ := batchInstruments(noopMeter, name)
+		return bm
+	}
+	bm, err := batchInstruments(otel.Meter("kawa/batcher"), name)
+	if err != nil {
+		slog.Error("batcher: creating metrics, disabling", "batcher", name, "error", err)
+		bm, _ = batchInstruments(noopMeter, name)
+	}
+	return bm
+}
+
+func batchInstruments(meter metric.Meter, name string) (*batchMetrics, error) {
+	bm := &batchMetrics{
+		attrs: metric.WithAttributes(attribute.String("batcher", name)),
+	}
+	var err, e error
+	bm.batchSize, e = meter.Int64Histogram("kawa.batcher.batch.size",
+		metric.WithDescription("Messages per flushed batch"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	bm.flushDuration, e = meter.Float64Histogram("kawa.batcher.flush.duration",
+		metric.WithDescription("Time spent flushing a batch"),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	bm.flushErrors, e = meter.Int64Counter("kawa.batcher.flush.errors",
+		metric.WithDescription("Flushes which returned an error"),
+		metric.WithUnit("{error}"))
+	err = errors.Join(err, e)
+	bm.queueDepth, e = meter.Int64UpDownCounter("kawa.batcher.queue.depth",
+		metric.WithDescription("Messages buffered and waiting to be flushed"),
+		metric.WithUnit("{message}"))
+	err = errors.Join(err, e)
+	bm.queueBytes, e = meter.Int64UpDownCounter("kawa.batcher.queue.bytes",
+		metric.WithDescription("Size of the messages buffered and waiting to be flushed, as measured by the batcher's sizer"),
+		metric.WithUnit("By"))
+	err = errors.Join(err, e)
+	return bm, err
+}
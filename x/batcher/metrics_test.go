@@ -0,0 +1,85 @@
+package batch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestBatcherMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(prev)
+
+	flushed := make(chan struct{}, 2)
+	var calls int
+	var ff = func(c context.Context, msgs []kawa.Message[[]byte]) error {
+		defer func() { flushed <- struct{}{} }()
+		calls++
+		if calls == 2 {
+			return errors.New("flush failed")
+		}
+		return nil
+	}
+	bat := NewDestination[[]byte](FlushFunc[[]byte](ff), DiscardHandler[[]byte](),
+		FlushLength(2), FlushBytes(1000), FlushParallelism(1), Name("metered"), Metrics(true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error)
+	go func() { errc <- bat.Run(ctx) }()
+
+	for _, v := range []string{"a", "bb", "ccc", "dddd"} {
+		require.NoError(t, bat.Send(ctx, nil, kawa.Message[[]byte]{Value: []byte(v)}))
+	}
+	<-flushed
+	<-flushed
+	cancel()
+	require.NoError(t, <-errc)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	m := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			m[md.Name] = md.Data
+		}
+	}
+	name := attribute.String("batcher", "metered")
+
+	sizes := m["kawa.batcher.batch.size"].(metricdata.Histogram[int64])
+	require.Len(t, sizes.DataPoints, 1)
+	assert.Equal(t, uint64(2), sizes.DataPoints[0].Count)
+	assert.Equal(t, int64(4), sizes.DataPoints[0].Sum)
+	assert.Equal(t, name.Value, mustValue(t, sizes.DataPoints[0].Attributes, "batcher"))
+
+	durations := m["kawa.batcher.flush.duration"].(metricdata.Histogram[float64])
+	require.Len(t, durations.DataPoints, 1)
+	assert.Equal(t, uint64(2), durations.DataPoints[0].Count)
+
+	for metric, want := range map[string]int64{
+		"kawa.batcher.flush.errors": 1,
+		"kawa.batcher.queue.depth":  0,
+		"kawa.batcher.queue.bytes":  0,
+	} {
+		s := m[metric].(metricdata.Sum[int64])
+		require.Len(t, s.DataPoints, 1, metric)
+		assert.Equal(t, want, s.DataPoints[0].Value, metric)
+		assert.Equal(t, name.Value, mustValue(t, s.DataPoints[0].Attributes, "batcher"), metric)
+	}
+}
+
+func mustValue(t *testing.T, set attribute.Set, key attribute.Key) attribute.Value {
+	v, ok := set.Value(key)
+	require.True(t, ok, "missing attribute %s", key)
+	return v
+}
@@ -0,0 +1,29 @@
+// Package cbor provides a kawa codec for CBOR (RFC 8949), a compact binary
+// alternative to JSON.  Importing it registers the "cbor" format with
+// kawa.RegisterFormat.
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/runreveal/kawa"
+)
+
+func init() {
+	kawa.RegisterFormat("cbor", Format{})
+}
+
+// Format implements kawa.Format using github.com/fxamacker/cbor.
+type Format struct{}
+
+func (Format) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (Format) Unmarshal(data []byte, v any) error {
+	return cbor.Unmarshal(data, v)
+}
+
+// Codec returns a kawa.Codec for T encoding values as CBOR.
+func Codec[T any]() kawa.Codec[T] {
+	return kawa.FormatCodec[T](Format{})
+}
@@ -0,0 +1,25 @@
+package cbor
+
+import (
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	Name  string
+	Count int
+}
+
+func TestCodec(t *testing.T) {
+	c, err := kawa.CodecFor[event]("cbor")
+	require.NoError(t, err)
+
+	bts, err := c.Encode(event{Name: "login", Count: 3})
+	require.NoError(t, err)
+	ev, err := c.Decode(bts)
+	require.NoError(t, err)
+	assert.Equal(t, event{Name: "login", Count: 3}, ev)
+}
@@ -0,0 +1,207 @@
+// Package dedup provides a handler which drops duplicate messages, such as
+// those redelivered by at-least-once sources.
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/runreveal/kawa"
+)
+
+type Opts struct {
+	TTL               time.Duration
+	Bloom             bool
+	BloomCapacity     int
+	FalsePositiveRate float64
+}
+
+// TTL sets how long the identity of a message is remembered after it's first
+// seen.  Defaults to 10 minutes.
+func TTL(d time.Duration) func(*Opts) {
+	return func(opts *Opts) {
+		opts.TTL = d
+	}
+}
+
+// Bloom bounds the memory used to remember identities by storing them in a
+// pair of Bloom filters instead of a map.  Each filter is sized for capacity
+// identities per TTL with the given false positive rate, and the filters are
+// rotated every TTL, so identities are remembered for between one and two
+// TTLs.  A false positive causes a message which isn't a duplicate to be
+// dropped, so the rate should be chosen accordingly.
+func Bloom(capacity int, falsePositiveRate float64) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Bloom = true
+		opts.BloomCapacity = capacity
+		opts.FalsePositiveRate = falsePositiveRate
+	}
+}
+
+// Dedup is a kawa.Handler which passes through each message the first time its
+// identity is seen, and drops messages whose identity was seen within the TTL.
+// Dropped messages are acknowledged by the processor as they produce no
+// output.  Messages with an empty identity can't be told apart, so they're
+// always passed through.
+//
+// When run by a Processor, an identity is only remembered once the message
+// has been acknowledged by the destination.  Until then it's pending, and
+// duplicates arriving meanwhile are dropped too, but if delivering the message
+// fails the identity is forgotten, so that the redelivery of a nacked message
+// is passed through.  A pending identity which is neither acknowledged nor
+// fails, e.g. because the processor stopped, is forgotten after the TTL.
+type Dedup[T any] struct {
+	identity func(kawa.Message[T]) string
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	pending   map[string]time.Time
+	seen      map[string]time.Time
+	swept     time.Time
+	cur, prev *bloom
+	rotated   time.Time
+	newBloom  func() *bloom
+}
+
+// New returns a Dedup handler identifying messages with identity.  If identity
+// is nil, messages are identified by their Key.  New panics if the TTL isn't
+// positive or the Bloom filter parameters are invalid.
+func New[T any](identity func(kawa.Message[T]) string, opts ...func(*Opts)) *Dedup[T] {
+	cfg := Opts{
+		TTL:               10 * time.Minute,
+		BloomCapacity:     100000,
+		FalsePositiveRate: 0.001,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.TTL <= 0 {
+		panic("dedup: TTL must be positive")
+	}
+	if identity == nil {
+		identity = func(m kawa.Message[T]) string { return m.Key }
+	}
+
+	d := &Dedup[T]{
+		identity: identity,
+		ttl:      cfg.TTL,
+		now:      time.Now,
+		pending:  make(map[string]time.Time),
+	}
+	if cfg.Bloom {
+		if cfg.BloomCapacity < 1 || cfg.FalsePositiveRate <= 0 || cfg.FalsePositiveRate >= 1 {
+			panic("dedup: invalid bloom filter capacity or false positive rate")
+		}
+		d.newBloom = func() *bloom { return newBloom(cfg.BloomCapacity, cfg.FalsePositiveRate) }
+		d.cur, d.prev = d.newBloom(), d.newBloom()
+	} else {
+		d.seen = make(map[string]time.Time)
+	}
+	return d
+}
+
+func (d *Dedup[T]) Handle(ctx context.Context, msg kawa.Message[T]) ([]kawa.Message[T], error) {
+	id := d.identity(msg)
+	if id == "" {
+		return []kawa.Message[T]{msg}, nil
+	}
+	if !d.reserve(id) {
+		return nil, nil
+	}
+	kawa.OnFailure(ctx, func() { d.forget(id) })
+	kawa.OnAck(ctx, func() { d.commit(id) })
+	return []kawa.Message[T]{msg}, nil
+}
+
+// Seen reports whether id was seen within the TTL, and remembers it if not.
+func (d *Dedup[T]) Seen(id string) bool {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.has(id, now) {
+		return true
+	}
+	d.remember(id, now)
+	return false
+}
+
+// reserve marks id as pending unless it was seen within the TTL or is already
+// pending, and reports whether it did so.
+func (d *Dedup[T]) reserve(id string) bool {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.has(id, now) {
+		return false
+	}
+	d.pending[id] = now.Add(d.ttl)
+	return true
+}
+
+// commit remembers the pending id once its message has been delivered.
+func (d *Dedup[T]) commit(id string) {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+	d.remember(id, now)
+}
+
+// forget drops the pending id after its message failed to be delivered.
+func (d *Dedup[T]) forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+}
+
+// has reports whether id is pending or was seen within the TTL.  It must be
+// called with d.mu held.
+func (d *Dedup[T]) has(id string, now time.Time) bool {
+	if now.Sub(d.swept) >= d.ttl {
+		for k, exp := range d.pending {
+			if !now.Before(exp) {
+				delete(d.pending, k)
+			}
+		}
+		for k, exp := range d.seen {
+			if !now.Before(exp) {
+				delete(d.seen, k)
+			}
+		}
+		d.swept = now
+	}
+	if exp, ok := d.pending[id]; ok && now.Before(exp) {
+		return true
+	}
+	if d.seen == nil {
+		return d.hasBloom(id, now)
+	}
+	exp, ok := d.seen[id]
+	return ok && now.Before(exp)
+}
+
+// remember records id as seen.  It must be called with d.mu held.
+func (d *Dedup[T]) remember(id string, now time.Time) {
+	if d.seen == nil {
+		d.cur.add(id)
+		return
+	}
+	d.seen[id] = now.Add(d.ttl)
+}
+
+func (d *Dedup[T]) hasBloom(id string, now time.Time) bool {
+	if d.rotated.IsZero() {
+		d.rotated = now
+	}
+	if now.Sub(d.rotated) >= d.ttl {
+		d.prev, d.cur = d.cur, d.newBloom()
+		if now.Sub(d.rotated) >= 2*d.ttl {
+			// Both filters have expired.
+			d.prev = d.newBloom()
+		}
+		d.rotated = now
+	}
+	return d.cur.has(id) || d.prev.has(id)
+}
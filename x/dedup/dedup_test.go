@@ -0,0 +1,135 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/runreveal/kawa/x/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []func(*Opts)
+	}{
+		{"map", nil},
+		{"bloom", []func(*Opts){Bloom(1000, 0.0001)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+			d := New[string](nil, append(tc.opts, TTL(time.Minute))...)
+			d.now = func() time.Time { return now }
+
+			handle := func(key string) int {
+				out, err := d.Handle(context.Background(), kawa.Message[string]{Key: key})
+				require.NoError(t, err)
+				return len(out)
+			}
+
+			assert.Equal(t, 1, handle("a"))
+			assert.Equal(t, 1, handle("b"))
+			assert.Equal(t, 0, handle("a"))
+
+			// Identities are forgotten after at most two TTLs.
+			now = now.Add(2*time.Minute + time.Second)
+			assert.Equal(t, 1, handle("a"))
+			assert.Equal(t, 0, handle("a"))
+		})
+	}
+}
+
+func TestDedupIdentity(t *testing.T) {
+	d := New(func(m kawa.Message[int]) string { return fmt.Sprint(m.Value) })
+	out, err := d.Handle(context.Background(), kawa.Message[int]{Key: "x", Value: 1})
+	require.NoError(t, err)
+	assert.Len(t, out, 1)
+	out, err = d.Handle(context.Background(), kawa.Message[int]{Key: "y", Value: 1})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestDedupEmptyIdentity(t *testing.T) {
+	d := New[string](nil)
+	for i := 0; i < 2; i++ {
+		out, err := d.Handle(context.Background(), kawa.Message[string]{Value: "keyless"})
+		require.NoError(t, err)
+		assert.Len(t, out, 1, "messages without an identity should be passed through")
+	}
+}
+
+func TestDedupInvalidTTL(t *testing.T) {
+	assert.Panics(t, func() { New[string](nil, TTL(0)) })
+	assert.Panics(t, func() { New[string](nil, TTL(-time.Second), Bloom(100, 0.01)) })
+}
+
+func TestBloomFalsePositives(t *testing.T) {
+	b := newBloom(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.add(fmt.Sprint("in-", i))
+	}
+	var fp int
+	for i := 0; i < 10000; i++ {
+		require.True(t, b.has(fmt.Sprint("in-", i)))
+		if b.has(fmt.Sprint("out-", i)) {
+			fp++
+		}
+	}
+	assert.Less(t, fp, 300)
+}
+
+func TestDedupRedeliveryAfterNack(t *testing.T) {
+	in := make(chan string, 3)
+	src := memory.NewMemSource[string](in)
+	delivered := make(chan string, 3)
+	var sends int
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		sends++
+		if sends == 1 {
+			return kawa.Retryable(errors.New("unavailable"))
+		}
+		for _, m := range msgs {
+			delivered <- m.Value
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+	d := New(func(m kawa.Message[string]) string { return m.Value })
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     d,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	next := func() string {
+		select {
+		case v := <-delivered:
+			return v
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for delivery")
+			return ""
+		}
+	}
+
+	// The first send fails and is nacked, so the redelivery isn't a duplicate.
+	in <- "a"
+	assert.Equal(t, "a", next())
+	// Once delivered, it is.
+	in <- "a"
+	in <- "b"
+	assert.Equal(t, "b", next())
+	assert.Empty(t, delivered)
+
+	cancel()
+	assert.NoError(t, <-errc)
+}
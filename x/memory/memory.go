@@ -3,27 +3,53 @@ package memory
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/runreveal/kawa"
+	"github.com/runreveal/kawa/internal/requeue"
 )
 
 type MemorySource[T any] struct {
 	MsgC <-chan T
+	// requeue holds nacked values for redelivery.  It's nil unless the
+	// source was created with NewMemSource.
+	requeue *requeue.Queue[T]
 }
 
 func NewMemSource[T any](in <-chan T) MemorySource[T] {
 	return MemorySource[T]{
-		MsgC: in,
+		MsgC:    in,
+		requeue: requeue.New[T](),
 	}
 }
 
 func (ms MemorySource[T]) Recv(ctx context.Context) (kawa.Message[T], func(), error) {
-	select {
-	case <-ctx.Done():
-		return kawa.Message[T]{}, nil, ctx.Err()
-	case v := <-ms.MsgC:
-		return kawa.Message[T]{Value: v}, nil, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return kawa.Message[T]{}, nil, ctx.Err()
+		case <-ms.requeue.Ready():
+			if v, ok := ms.requeue.Pop(); ok {
+				return kawa.Message[T]{Value: v}, nil, nil
+			}
+		case v := <-ms.MsgC:
+			return kawa.Message[T]{Value: v}, nil, nil
+		}
+	}
+}
+
+// RecvWithNack satisfies kawa.NackSource.  Nacked values are redelivered from
+// Recv after the requested delay, interleaved with values from MsgC.  The nack func is
+// nil if the source wasn't created with NewMemSource.
+func (ms MemorySource[T]) RecvWithNack(ctx context.Context) (kawa.Message[T], func(), kawa.NackFunc, error) {
+	msg, ack, err := ms.Recv(ctx)
+	if err != nil || ms.requeue == nil {
+		return msg, ack, nil, err
+	}
+	nack := func(_ error, requeueAfter time.Duration) {
+		ms.requeue.After(msg.Value, requeueAfter)
 	}
+	return msg, ack, nack, nil
 }
 
 type MemoryDestination[T any] struct {
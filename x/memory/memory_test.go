@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemSourceNackRedelivers(t *testing.T) {
+	in := make(chan string, 2)
+	src := NewMemSource[string](in)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	in <- "a"
+	msg, _, nack, err := src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, nack)
+	assert.Equal(t, "a", msg.Value)
+
+	// The nacked value is redelivered after the delay, so values arriving
+	// in the meantime are received first.
+	nack(errors.New("failed"), 50*time.Millisecond)
+	in <- "b"
+	msg, _, _, err = src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "b", msg.Value)
+
+	start := time.Now()
+	msg, _, nack, err = src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Value)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// A redelivered value can be nacked again.
+	nack(errors.New("failed again"), 0)
+	msg, _, _, err = src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Value)
+}
+
+func TestMemSourceNackWithoutConstructor(t *testing.T) {
+	in := make(chan string, 1)
+	src := MemorySource[string]{MsgC: in}
+
+	in <- "a"
+	msg, _, nack, err := src.RecvWithNack(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Value)
+	assert.Nil(t, nack, "values can't be redelivered without a requeue")
+}
@@ -0,0 +1,18 @@
+package mqtt
+
+import "github.com/runreveal/kawa"
+
+// Attributes are set on messages received by the Source.  Use
+// kawa.AttributesAs to retrieve them.
+type Attributes struct {
+	QoS       byte
+	Retained  bool
+	Duplicate bool
+	// MessageID is the MQTT packet identifier, which is only unique among the
+	// messages in flight.
+	MessageID uint16
+}
+
+func (a Attributes) Unwrap() kawa.Attributes {
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/runreveal/kawa"
+	"github.com/runreveal/kawa/internal/requeue"
+	"github.com/segmentio/ksuid"
 )
 
 type OptFunc func(*Opts)
@@ -106,11 +108,11 @@ func NewDestination(opts ...OptFunc) (*Destination, error) {
 	cfg := loadOpts(opts)
 	ret := &Destination{
 		cfg:  cfg,
-		errc: make(chan error),
+		errc: make(chan error, 1),
 	}
 
 	connLost := func(client MQTT.Client, err error) {
-		ret.errc <- err
+		lost(ret.errc, err)
 	}
 
 	var err error
@@ -153,7 +155,36 @@ func clientConnect(opts Opts, onLost MQTT.ConnectionLostHandler) (MQTT.Client, e
 	return client, nil
 }
 
+// lost reports a lost connection to Run without blocking the client if Run
+// isn't running.
+func lost(errc chan error, err error) {
+	select {
+	case errc <- err:
+	default:
+	}
+}
+
+// reconnect connects client again if it was disconnected by a previous call to
+// Run, so that Run may be called again after it returns, e.g. by a
+// supervisor.  Connection losses reported before reconnecting are discarded.
+func reconnect(client MQTT.Client, errc chan error) error {
+	if client.IsConnectionOpen() {
+		return nil
+	}
+	select {
+	case <-errc:
+	default:
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("mqtt connect error: %s", token.Error())
+	}
+	return nil
+}
+
 func (dest *Destination) Run(ctx context.Context) error {
+	if err := reconnect(dest.client, dest.errc); err != nil {
+		return err
+	}
 	var err error
 	select {
 	case err = <-dest.errc:
@@ -169,30 +200,36 @@ func (dest *Destination) Send(ctx context.Context, ack func(), msgs ...kawa.Mess
 		token := dest.client.Publish(dest.cfg.topic, dest.cfg.qos, dest.cfg.retained, string(msg.Value))
 		token.Wait()
 		if token.Error() != nil {
-			return token.Error()
+			// Messages published before the failure are published again if
+			// the send is retried, which MQTT's at-least-once delivery
+			// permits.
+			return kawa.Retryable(token.Error())
 		}
 	}
+	kawa.Ack(ack)
 	return nil
 }
 
 type Source struct {
-	msgC   chan msgAck
-	cfg    Opts
-	errc   chan error
-	client MQTT.Client
+	msgC    chan msgAck
+	requeue *requeue.Queue[msgAck]
+	cfg     Opts
+	errc    chan error
+	client  MQTT.Client
 }
 
 func NewSource(opts ...OptFunc) (*Source, error) {
 	cfg := loadOpts(opts)
 
 	ret := &Source{
-		msgC: make(chan msgAck),
-		cfg:  cfg,
-		errc: make(chan error),
+		msgC:    make(chan msgAck),
+		requeue: requeue.New[msgAck](),
+		cfg:     cfg,
+		errc:    make(chan error, 1),
 	}
 
 	connLost := func(client MQTT.Client, err error) {
-		ret.errc <- err
+		lost(ret.errc, err)
 	}
 
 	var err error
@@ -205,6 +242,9 @@ func NewSource(opts ...OptFunc) (*Source, error) {
 }
 
 func (src *Source) Run(ctx context.Context) error {
+	if err := reconnect(src.client, src.errc); err != nil {
+		return err
+	}
 	return src.recvLoop(ctx)
 }
 
@@ -216,6 +256,16 @@ func (src *Source) recvLoop(ctx context.Context) error {
 				Value: message.Payload(),
 				Key:   strconv.FormatUint(uint64(message.MessageID()), 10),
 				Topic: message.Topic(),
+				// MQTT message IDs are only unique among messages in flight,
+				// so generate one instead.
+				ID:         ksuid.New().String(),
+				IngestTime: time.Now(),
+				Attributes: Attributes{
+					QoS:       message.Qos(),
+					Retained:  message.Retained(),
+					Duplicate: message.Duplicate(),
+					MessageID: message.MessageID(),
+				},
 			},
 			ack: message.Ack,
 		}:
@@ -242,10 +292,30 @@ func (src *Source) recvLoop(ctx context.Context) error {
 }
 
 func (src *Source) Recv(ctx context.Context) (kawa.Message[[]byte], func(), error) {
-	select {
-	case <-ctx.Done():
-		return kawa.Message[[]byte]{}, nil, ctx.Err()
-	case pass := <-src.msgC:
-		return pass.msg, pass.ack, nil
+	msg, ack, _, err := src.RecvWithNack(ctx)
+	return msg, ack, err
+}
+
+// RecvWithNack satisfies kawa.NackSource.  MQTT has no way of asking the
+// broker to redeliver a message, so nacked messages are redelivered from Recv
+// by the source itself after the requested delay.  They're acknowledged to the
+// broker once the redelivery is acknowledged.
+func (src *Source) RecvWithNack(ctx context.Context) (kawa.Message[[]byte], func(), kawa.NackFunc, error) {
+	for {
+		var pass msgAck
+		select {
+		case <-ctx.Done():
+			return kawa.Message[[]byte]{}, nil, nil, ctx.Err()
+		case <-src.requeue.Ready():
+			var ok bool
+			if pass, ok = src.requeue.Pop(); !ok {
+				continue
+			}
+		case pass = <-src.msgC:
+		}
+		nack := func(_ error, requeueAfter time.Duration) {
+			src.requeue.After(pass, requeueAfter)
+		}
+		return pass.msg, pass.ack, nack, nil
 	}
 }
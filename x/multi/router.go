@@ -0,0 +1,100 @@
+package multi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/runreveal/kawa"
+)
+
+// Route sends the messages for which Match returns true to Destination.
+type Route[T any] struct {
+	// Name identifies the route in errors.
+	Name string
+	// Match reports whether the message should be sent to this route.  A nil
+	// Match matches every message.
+	Match func(kawa.Message[T]) bool
+	// Destination receives the matching messages.
+	Destination kawa.Destination[T]
+	// Continue causes the subsequent routes to be evaluated after this route
+	// matches a message.  By default, a message is sent only to the first
+	// route that matches it.
+	Continue bool
+}
+
+// Router is a destination which sends each message only to the destinations of
+// the routes that match it.  Routes are evaluated in order.  Messages which
+// don't match any route are sent to the fallback destination, or dropped if
+// there is none.
+//
+// The ack passed to Send is called once every destination that received at
+// least one of the messages has acknowledged them.  If none of the messages
+// were sent anywhere, ack is called immediately.
+type Router[T any] struct {
+	routes   []Route[T]
+	fallback kawa.Destination[T]
+}
+
+// NewRouter creates a Router from the given routes.  fallback may be nil.
+func NewRouter[T any](routes []Route[T], fallback kawa.Destination[T]) Router[T] {
+	for _, r := range routes {
+		if r.Destination == nil {
+			panic(fmt.Sprintf("route %q: Destination must not be nil", r.Name))
+		}
+	}
+	return Router[T]{
+		routes:   routes,
+		fallback: fallback,
+	}
+}
+
+func (r Router[T]) Send(ctx context.Context, ack func(), msgs ...kawa.Message[T]) error {
+	// The last slot holds messages for the fallback destination.
+	routed := make([][]kawa.Message[T], len(r.routes)+1)
+	for _, msg := range msgs {
+		matched := false
+		for i, rt := range r.routes {
+			if rt.Match != nil && !rt.Match(msg) {
+				continue
+			}
+			routed[i] = append(routed[i], msg)
+			matched = true
+			if !rt.Continue {
+				break
+			}
+		}
+		if !matched && r.fallback != nil {
+			routed[len(r.routes)] = append(routed[len(r.routes)], msg)
+		}
+	}
+
+	var sends int
+	for _, batch := range routed {
+		if len(batch) > 0 {
+			sends++
+		}
+	}
+	if sends == 0 {
+		kawa.Ack(ack)
+		return nil
+	}
+	if ack != nil {
+		ack = ackFn(ack, sends)
+	}
+
+	for i, batch := range routed {
+		if len(batch) == 0 {
+			continue
+		}
+		if i == len(r.routes) {
+			if err := r.fallback.Send(ctx, ack, batch...); err != nil {
+				return fmt.Errorf("fallback route: %w", err)
+			}
+			continue
+		}
+		if err := r.routes[i].Destination.Send(ctx, ack, batch...); err != nil {
+			return fmt.Errorf("route %q: %w", r.routes[i].Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package multi
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	msgs []string
+}
+
+func (r *recorder) Send(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+	for _, m := range msgs {
+		r.msgs = append(r.msgs, m.Value)
+	}
+	kawa.Ack(ack)
+	return nil
+}
+
+func TestRouter(t *testing.T) {
+	hasPrefix := func(p string) func(kawa.Message[string]) bool {
+		return func(m kawa.Message[string]) bool { return strings.HasPrefix(m.Value, p) }
+	}
+
+	security, audit, debug, rest := &recorder{}, &recorder{}, &recorder{}, &recorder{}
+	router := NewRouter[string]([]Route[string]{
+		{Name: "security", Match: hasPrefix("sec"), Destination: security, Continue: true},
+		{Name: "audit", Match: hasPrefix("sec-audit"), Destination: audit},
+		{Name: "debug", Match: hasPrefix("debug"), Destination: debug},
+	}, rest)
+
+	acks := 0
+	err := router.Send(context.Background(), func() { acks++ },
+		kawa.Message[string]{Value: "sec-login"},
+		kawa.Message[string]{Value: "sec-audit-1"},
+		kawa.Message[string]{Value: "debug-noise"},
+		kawa.Message[string]{Value: "other"},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"sec-login", "sec-audit-1"}, security.msgs)
+	assert.Equal(t, []string{"sec-audit-1"}, audit.msgs)
+	assert.Equal(t, []string{"debug-noise"}, debug.msgs)
+	assert.Equal(t, []string{"other"}, rest.msgs)
+	assert.Equal(t, 1, acks, "ack should be called once after all routes ack")
+
+	t.Run("unmatched without fallback are acked", func(t *testing.T) {
+		router := NewRouter[string]([]Route[string]{
+			{Name: "debug", Match: hasPrefix("debug"), Destination: debug},
+		}, nil)
+		acks := 0
+		err := router.Send(context.Background(), func() { acks++ }, kawa.Message[string]{Value: "other"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, acks)
+	})
+}
@@ -0,0 +1,107 @@
+// Package offset helps sources which track their position by offset, such as
+// Kafka partitions, byte offsets in files or polling cursors, to commit only
+// positions whose messages have all been acknowledged.
+package offset
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Tracker hands out ack funcs for offsets and tracks the committable
+// watermark: the highest offset such that it and every offset tracked before
+// it have been acknowledged.  Acks may arrive in any order, e.g. when the
+// processor runs with Parallelism or destinations flush concurrently.
+//
+// An ack sets a flag and then, unless another ack is already doing so,
+// advances the watermark past the acknowledged offsets at the front.  Both
+// acks and Track briefly take a shared lock, so they may wait on each other,
+// but only one ack at a time does the work of advancing.  A Tracker is safe
+// for concurrent use.
+type Tracker struct {
+	watermark atomic.Int64
+
+	// mu guards pending and last.  Offsets are appended to pending in the
+	// order they're tracked and removed from the front as they're committed.
+	mu      sync.Mutex
+	pending []*entry
+	last    int64
+
+	advancing sync.Mutex
+}
+
+type entry struct {
+	offset int64
+	done   atomic.Bool
+}
+
+// New returns a Tracker whose watermark is initially committed, e.g. the last
+// offset committed by a previous run, or -1 if there is none.
+func New(committed int64) *Tracker {
+	t := &Tracker{last: committed}
+	t.watermark.Store(committed)
+	return t
+}
+
+// Track starts tracking offset and returns the func which acknowledges it.
+// Offsets must be tracked in increasing order, but needn't be contiguous.
+// Calling the returned func more than once has no further effect.
+func (t *Tracker) Track(offset int64) func() {
+	e := &entry{offset: offset}
+	t.mu.Lock()
+	if offset <= t.last {
+		t.mu.Unlock()
+		panic(fmt.Sprintf("offset: tracked %d after %d, offsets must be increasing", offset, t.last))
+	}
+	t.last = offset
+	t.pending = append(t.pending, e)
+	t.mu.Unlock()
+
+	return func() {
+		if e.done.CompareAndSwap(false, true) {
+			t.advance()
+		}
+	}
+}
+
+// advance moves the watermark past the acknowledged offsets at the front of
+// pending.  If another goroutine is already advancing, it's left to do so.
+func (t *Tracker) advance() {
+	for t.advancing.TryLock() {
+		t.mu.Lock()
+		n := 0
+		for n < len(t.pending) && t.pending[n].done.Load() {
+			n++
+		}
+		if n > 0 {
+			t.watermark.Store(t.pending[n-1].offset)
+			// Clear the references so the entries can be collected.
+			clear(t.pending[:n])
+			t.pending = t.pending[n:]
+		}
+		t.mu.Unlock()
+		t.advancing.Unlock()
+
+		// An ack which arrived while we were advancing may have failed to
+		// take the lock, so check whether there's more to do.
+		t.mu.Lock()
+		more := len(t.pending) > 0 && t.pending[0].done.Load()
+		t.mu.Unlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// Committable returns the current watermark.
+func (t *Tracker) Committable() int64 {
+	return t.watermark.Load()
+}
+
+// Pending returns the number of tracked offsets not yet committable.
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
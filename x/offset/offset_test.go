@@ -0,0 +1,56 @@
+package offset
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tr := New(-1)
+	acks := make([]func(), 5)
+	for i := range acks {
+		acks[i] = tr.Track(int64(i * 10))
+	}
+
+	acks[1]()
+	acks[2]()
+	assert.Equal(t, int64(-1), tr.Committable())
+	acks[0]()
+	assert.Equal(t, int64(20), tr.Committable())
+	acks[4]()
+	acks[4]()
+	assert.Equal(t, int64(20), tr.Committable())
+	assert.Equal(t, 2, tr.Pending())
+	acks[3]()
+	assert.Equal(t, int64(40), tr.Committable())
+	assert.Equal(t, 0, tr.Pending())
+
+	assert.Panics(t, func() { tr.Track(40) })
+}
+
+func TestTrackerConcurrent(t *testing.T) {
+	const n = 10000
+	tr := New(-1)
+	acks := make([]func(), n)
+	for i := range acks {
+		acks[i] = tr.Track(int64(i))
+	}
+	rand.Shuffle(n, func(i, j int) { acks[i], acks[j] = acks[j], acks[i] })
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += 8 {
+				acks[i]()
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(n-1), tr.Committable())
+	assert.Equal(t, 0, tr.Pending())
+}
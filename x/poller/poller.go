@@ -2,9 +2,10 @@ package poller
 
 import (
 	"context"
-	"errors"
+	"time"
 
 	"github.com/runreveal/kawa"
+	"github.com/runreveal/kawa/internal/requeue"
 )
 
 type msgAck[T any] struct {
@@ -18,6 +19,7 @@ type Poller[T any] interface {
 
 type Source[T any] struct {
 	msgChan   chan msgAck[T]
+	requeue   *requeue.Queue[msgAck[T]]
 	batchSize int
 
 	poller Poller[T]
@@ -43,6 +45,7 @@ func New[T any](p Poller[T], opts ...Option) *Source[T] {
 	ret := &Source[T]{
 		poller:    p,
 		msgChan:   make(chan msgAck[T], cfg.BatchSize),
+		requeue:   requeue.New[msgAck[T]](),
 		batchSize: cfg.BatchSize,
 	}
 	return ret
@@ -72,11 +75,31 @@ func (s *Source[T]) recvLoop(ctx context.Context) error {
 }
 
 func (s *Source[T]) Recv(ctx context.Context) (kawa.Message[T], func(), error) {
-	select {
-	case <-ctx.Done():
-		return kawa.Message[T]{}, nil, ctx.Err()
-	case ma := <-s.msgChan:
-		return ma.msg, ma.ack, errors.New("not implemented")
+	msg, ack, _, err := s.RecvWithNack(ctx)
+	return msg, ack, err
+}
+
+// RecvWithNack satisfies kawa.NackSource.  Nacked messages are redelivered
+// from Recv after the requested delay, with the same ack func, so the batch
+// they were polled in is acknowledged once all of its messages, including
+// redeliveries, have been acknowledged.
+func (s *Source[T]) RecvWithNack(ctx context.Context) (kawa.Message[T], func(), kawa.NackFunc, error) {
+	for {
+		var ma msgAck[T]
+		select {
+		case <-ctx.Done():
+			return kawa.Message[T]{}, nil, nil, ctx.Err()
+		case <-s.requeue.Ready():
+			var ok bool
+			if ma, ok = s.requeue.Pop(); !ok {
+				continue
+			}
+		case ma = <-s.msgChan:
+		}
+		nack := func(_ error, requeueAfter time.Duration) {
+			s.requeue.After(ma, requeueAfter)
+		}
+		return ma.msg, ma.ack, nack, nil
 	}
 }
 
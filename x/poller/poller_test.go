@@ -0,0 +1,56 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pollFunc[T any] func(context.Context, int) ([]kawa.Message[T], func(), error)
+
+func (pf pollFunc[T]) Poll(ctx context.Context, n int) ([]kawa.Message[T], func(), error) {
+	return pf(ctx, n)
+}
+
+func TestPollerNackRedeliversBeforeBatchAck(t *testing.T) {
+	var polls, batchAcks atomic.Int32
+	p := pollFunc[string](func(ctx context.Context, n int) ([]kawa.Message[string], func(), error) {
+		if polls.Add(1) > 1 {
+			<-ctx.Done()
+			return nil, nil, ctx.Err()
+		}
+		msgs := []kawa.Message[string]{{Value: "a"}, {Value: "b"}}
+		return msgs, func() { batchAcks.Add(1) }, nil
+	})
+	src := New[string](p, WithBatchSize(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() { _ = src.Run(ctx) }()
+
+	msg, _, nack, err := src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, nack)
+	assert.Equal(t, "a", msg.Value)
+	nack(errors.New("failed"), 10*time.Millisecond)
+
+	msg, ack, _, err := src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "b", msg.Value)
+	ack()
+	assert.Zero(t, batchAcks.Load(), "batch acked before the nacked message was redelivered")
+
+	// The redelivered message carries the batch's ack, which fires once it
+	// has been acknowledged.
+	msg, ack, _, err = src.RecvWithNack(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Value)
+	ack()
+	assert.Equal(t, int32(1), batchAcks.Load())
+}
@@ -8,8 +8,9 @@ import (
 )
 
 type Printer struct {
-	writer io.Writer
-	delim  []byte
+	writer   io.Writer
+	delim    []byte
+	envelope bool
 }
 
 func WithDelim(delim []byte) func(*Printer) {
@@ -18,6 +19,14 @@ func WithDelim(delim []byte) func(*Printer) {
 	}
 }
 
+// WithEnvelope makes the printer write each message as a JSON kawa.Envelope
+// including its metadata, rather than only its value.
+func WithEnvelope(b bool) func(*Printer) {
+	return func(s *Printer) {
+		s.envelope = b
+	}
+}
+
 func NewPrinter(writer io.Writer, opts ...func(*Printer)) *Printer {
 	ret := &Printer{
 		writer: writer,
@@ -31,7 +40,14 @@ func NewPrinter(writer io.Writer, opts ...func(*Printer)) *Printer {
 
 func (p *Printer) Send(ctx context.Context, ack func(), msg ...kawa.Message[[]byte]) error {
 	for _, m := range msg {
-		toSend := append(m.Value, []byte(p.delim)...)
+		val := m.Value
+		if p.envelope {
+			var err error
+			if val, err = kawa.MarshalEnvelope(m); err != nil {
+				return err
+			}
+		}
+		toSend := append(val, []byte(p.delim)...)
 
 		_, err := p.writer.Write(toSend)
 		if err != nil {
@@ -61,6 +61,14 @@ func WithBatchSize(batchSize int) Option {
 	}
 }
 
+// WithEnvelope makes each line written to S3 a JSON kawa.Envelope including
+// the message's metadata, rather than only its value.
+func WithEnvelope(envelope bool) Option {
+	return func(s *S3) {
+		s.envelope = envelope
+	}
+}
+
 type S3 struct {
 	batcher *batch.Destination[[]byte]
 
@@ -73,6 +81,7 @@ type S3 struct {
 	secretAccessKey string
 
 	batchSize int
+	envelope  bool
 }
 
 func New(opts ...Option) *S3 {
@@ -87,6 +96,7 @@ func New(opts ...Option) *S3 {
 		batch.Raise[[]byte](),
 		batch.FlushLength(ret.batchSize),
 		batch.FlushFrequency(5*time.Second),
+		batch.FlushRetry(kawa.RetryPolicy{}),
 	)
 	return ret
 }
@@ -128,7 +138,13 @@ func (s *S3) Flush(ctx context.Context, msgs []kawa.Message[[]byte]) error {
 	var buf bytes.Buffer
 	gzipBuffer := gzip.NewWriter(&buf)
 	for _, msg := range msgs {
-		_, err := gzipBuffer.Write(msg.Value)
+		val := msg.Value
+		if s.envelope {
+			if val, err = kawa.MarshalEnvelope(msg); err != nil {
+				return err
+			}
+		}
+		_, err := gzipBuffer.Write(val)
 		if err != nil {
 			return err
 		}
@@ -156,7 +172,8 @@ func (s *S3) Flush(ctx context.Context, msgs []kawa.Message[[]byte]) error {
 	// Upload the file to S3
 	_, err = uploader.Upload(uploadInput)
 	if err != nil {
-		return err
+		// Nothing was written, so the upload may be retried.
+		return kawa.Retryable(err)
 	}
 	return nil
 }
@@ -0,0 +1,16 @@
+package scanner
+
+import "github.com/runreveal/kawa"
+
+// Attributes are set on messages received by the Scanner.  Use
+// kawa.AttributesAs to retrieve them.
+type Attributes struct {
+	// Line is the 1-based index of the message's token in the input.
+	Line int
+	// Offset is the byte offset of the start of the token in the input.
+	Offset int64
+}
+
+func (a Attributes) Unwrap() kawa.Attributes {
+	return nil
+}
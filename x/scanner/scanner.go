@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/runreveal/kawa"
+	"github.com/segmentio/ksuid"
 )
 
 type Scanner struct {
@@ -41,15 +43,32 @@ func (s *Scanner) Run(ctx context.Context) error {
 
 func (s *Scanner) recvLoop(ctx context.Context) error {
 	var wg sync.WaitGroup
-	s.scanner.Split(delimFunc(s.delim))
+	// track the offset of each token for its attributes
+	var pos, start int64
+	split := delimFunc(s.delim)
+	s.scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if token != nil {
+			start = pos
+		}
+		pos += int64(advance)
+		return advance, token, err
+	})
+	var line int
 	for s.scanner.Scan() {
 		bts := s.scanner.Bytes()
 		val := make([]byte, len(bts))
 		copy(val, bts)
+		line++
 		wg.Add(1)
 		select {
 		case s.msgC <- kawa.MsgAck[[]byte]{
-			Msg: kawa.Message[[]byte]{Value: val},
+			Msg: kawa.Message[[]byte]{
+				Value:      val,
+				ID:         ksuid.New().String(),
+				IngestTime: time.Now(),
+				Attributes: Attributes{Line: line, Offset: start},
+			},
 			Ack: func() {
 				wg.Done()
 			},
@@ -0,0 +1,29 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannerAttributes(t *testing.T) {
+	s := NewScanner(strings.NewReader("one\ntwo\n\nfour"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	want := []Attributes{{1, 0}, {2, 4}, {3, 8}, {4, 9}}
+	for _, w := range want {
+		msg, ack, err := s.Recv(ctx)
+		require.NoError(t, err)
+		kawa.Ack(ack)
+		attrs, ok := kawa.AttributesAs[Attributes](msg.Attributes)
+		require.True(t, ok)
+		assert.Equal(t, w, attrs)
+		assert.NotEmpty(t, msg.ID)
+	}
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/runreveal/kawa"
+)
+
+// File is a kawa.StateStore which keeps its state in memory and persists it to
+// a local file on Snapshot.  Use it with the kawa.Checkpoint option so that
+// the file is kept consistent with the messages acknowledged to the source.
+//
+// Snapshots are written to a temporary file which is renamed over the previous
+// snapshot, so the file always holds a complete snapshot even if the process
+// crashes while writing.
+type File struct {
+	*Memory
+	path string
+}
+
+var (
+	_ kawa.StateStore   = (*File)(nil)
+	_ kawa.Checkpointer = (*File)(nil)
+)
+
+// NewFile returns a File store persisted at path, loading the last snapshot
+// from path if it exists.
+func NewFile(path string) (*File, error) {
+	f := &File{Memory: NewMemory(), path: path}
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if err := json.Unmarshal(bts, &f.data); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	if f.data == nil {
+		f.data = make(map[string][]byte)
+	}
+	return f, nil
+}
+
+// Snapshot writes the current state to the store's file.
+func (f *File) Snapshot(ctx context.Context) error {
+	bts, err := json.Marshal(f.snapshot())
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	// Clean up if anything fails before the rename.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bts); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+	return nil
+}
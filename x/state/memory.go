@@ -0,0 +1,93 @@
+// Package state provides implementations of kawa.StateStore.
+package state
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/runreveal/kawa"
+)
+
+// Memory is a kawa.StateStore which keeps its state in memory only.  Its state
+// is lost when the process exits.
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+var _ kawa.StateStore = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string][]byte)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.data[key]
+	if !ok {
+		return nil, kawa.ErrKeyNotFound
+	}
+	return clone(v), nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = clone(value)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// Scan calls fn for each key with the given prefix in key order.  fn is called
+// with a consistent view of the store taken when Scan was called, so it may
+// modify the store.
+func (m *Memory) Scan(ctx context.Context, prefix string, fn func(key string, value []byte) error) error {
+	m.mu.RLock()
+	var keys []string
+	vals := make(map[string][]byte)
+	for k, v := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+			vals[k] = clone(v)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(k, vals[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of the store's contents.
+func (m *Memory) snapshot() map[string][]byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cp := make(map[string][]byte, len(m.data))
+	for k, v := range m.data {
+		cp[k] = v
+	}
+	return cp
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	_, err := m.Get(ctx, "missing")
+	assert.ErrorIs(t, err, kawa.ErrKeyNotFound)
+
+	require.NoError(t, m.Put(ctx, "user/b", []byte("2")))
+	require.NoError(t, m.Put(ctx, "user/a", []byte("1")))
+	require.NoError(t, m.Put(ctx, "host/a", []byte("3")))
+
+	v, err := m.Get(ctx, "user/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	var keys []string
+	err = m.Scan(ctx, "user/", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user/a", "user/b"}, keys)
+
+	require.NoError(t, m.Delete(ctx, "user/a"))
+	_, err = m.Get(ctx, "user/a")
+	assert.ErrorIs(t, err, kawa.ErrKeyNotFound)
+}
+
+func TestFileSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	f, err := NewFile(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Put(ctx, "a", []byte("1")))
+	require.NoError(t, f.Snapshot(ctx))
+	// Changes after the last snapshot are lost on restart.
+	require.NoError(t, f.Put(ctx, "b", []byte("2")))
+
+	f, err = NewFile(path)
+	require.NoError(t, err)
+	v, err := f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+	_, err = f.Get(ctx, "b")
+	assert.ErrorIs(t, err, kawa.ErrKeyNotFound)
+}
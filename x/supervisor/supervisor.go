@@ -0,0 +1,274 @@
+// Package supervisor restarts long running components, such as a
+// kawa.Processor, batcher.Destination or mqtt.Source, when their Run method
+// fails, so that a transient failure of one component doesn't take down the
+// whole program.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/runreveal/kawa"
+)
+
+// Runner is anything following the Configure and Run pattern.
+type Runner interface {
+	Run(context.Context) error
+}
+
+// RunFunc is a convenience type to use a function as a Runner.
+type RunFunc func(context.Context) error
+
+func (rf RunFunc) Run(ctx context.Context) error {
+	return rf(ctx)
+}
+
+type Opts struct {
+	Backoff     kawa.RetryPolicy
+	ResetAfter  time.Duration
+	MaxRestarts int
+	Window      time.Duration
+	Escalate    func(ctx context.Context, err *EscalationError) error
+	Logger      *slog.Logger
+}
+
+// Backoff sets the delay between restarts of a runner.  Only the
+// InitialBackoff, MaxBackoff, Multiplier and Jitter fields are used.  Defaults
+// to the kawa.RetryPolicy defaults: 100ms doubling up to 30s.
+func Backoff(rp kawa.RetryPolicy) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Backoff = rp
+	}
+}
+
+// ResetAfter sets how long a runner must run before failing for the delay
+// before restarting it to be reset to the initial backoff.  Defaults to 1
+// minute.
+func ResetAfter(d time.Duration) func(*Opts) {
+	return func(opts *Opts) {
+		opts.ResetAfter = d
+	}
+}
+
+// Budget sets the maximum number of times a runner may be restarted within
+// window before the failure is escalated.  Defaults to 10 restarts per 10
+// minutes.  A negative maxRestarts allows unlimited restarts.
+func Budget(maxRestarts int, window time.Duration) func(*Opts) {
+	return func(opts *Opts) {
+		opts.MaxRestarts = maxRestarts
+		opts.Window = window
+	}
+}
+
+// Escalate sets the func called when a runner exhausts its restart budget.  If
+// it returns an error, the supervisor stops all of its runners and Run returns
+// that error.  If it returns nil, the runner's budget is reset and it's
+// restarted.  By default, the EscalationError is returned.
+func Escalate(fn func(ctx context.Context, err *EscalationError) error) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Escalate = fn
+	}
+}
+
+// Logger sets the logger restarts and escalations are reported to.  Defaults to
+// slog.Default().
+func Logger(l *slog.Logger) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Logger = l
+	}
+}
+
+// EscalationError is passed to the Escalate func, and returned from Run by
+// default, when a runner exhausts its restart budget.
+type EscalationError struct {
+	// Name is the name the runner was added with.
+	Name string
+	// Restarts is the number of restarts within Window.
+	Restarts int
+	Window   time.Duration
+	// Err is the error the runner last failed with.
+	Err error
+}
+
+func (ee *EscalationError) Error() string {
+	return fmt.Sprintf("supervisor: %s restarted %d times in %s: %v", ee.Name, ee.Restarts, ee.Window, ee.Err)
+}
+
+func (ee *EscalationError) Unwrap() error {
+	return ee.Err
+}
+
+type child struct {
+	name   string
+	runner Runner
+}
+
+// Supervisor runs a set of runners, restarting each with exponential backoff
+// when it fails.  A runner which returns nil, or fails after the context passed
+// to Run is done, isn't restarted.  Panics are recovered and treated as
+// failures.
+type Supervisor struct {
+	backoff     kawa.RetryPolicy
+	resetAfter  time.Duration
+	maxRestarts int
+	window      time.Duration
+	escalate    func(context.Context, *EscalationError) error
+	logger      *slog.Logger
+
+	mu       sync.Mutex
+	children []child
+	running  bool
+}
+
+func New(opts ...func(*Opts)) *Supervisor {
+	cfg := Opts{
+		ResetAfter:  time.Minute,
+		MaxRestarts: 10,
+		Window:      10 * time.Minute,
+		Escalate: func(_ context.Context, err *EscalationError) error {
+			return err
+		},
+		Logger: slog.Default(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.MaxRestarts >= 0 && cfg.Window <= 0 {
+		panic("supervisor: restart budget requires a positive window")
+	}
+	return &Supervisor{
+		backoff:     cfg.Backoff,
+		resetAfter:  cfg.ResetAfter,
+		maxRestarts: cfg.MaxRestarts,
+		window:      cfg.Window,
+		escalate:    cfg.Escalate,
+		logger:      cfg.Logger,
+	}
+}
+
+// Add adds a runner to be supervised under name, which identifies it in logs
+// and errors.  Add must be called before Run.
+func (s *Supervisor) Add(name string, r Runner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		panic("supervisor: Add called after Run")
+	}
+	s.children = append(s.children, child{name: name, runner: r})
+}
+
+// Run runs the supervised runners until ctx is canceled, or until one of them
+// exhausts its restart budget and the escalation fails.  In the latter case
+// the other runners are stopped, and the escalation's error is returned.  As
+// with kawa.Processor, Run returns nil when ctx is canceled.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		panic("supervisor: already running")
+	}
+	s.running = true
+	children := s.children
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, len(children))
+	var wg sync.WaitGroup
+	for _, c := range children {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.supervise(ctx, c); err != nil {
+				errc <- err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	if err := <-errc; err != nil {
+		return err
+	}
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// supervise runs c until it returns nil, ctx is done, or the escalation of a
+// failure returns an error.
+func (s *Supervisor) supervise(ctx context.Context, c child) error {
+	var (
+		attempt  int
+		restarts []time.Time
+	)
+	for {
+		start := time.Now()
+		err := run(ctx, c.runner)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			s.logger.Info("supervisor: runner exited", "name", c.name)
+			return nil
+		}
+		if time.Since(start) >= s.resetAfter {
+			attempt = 0
+		}
+		attempt++
+
+		if s.maxRestarts >= 0 {
+			now := time.Now()
+			restarts = prune(restarts, now.Add(-s.window))
+			if len(restarts) >= s.maxRestarts {
+				ee := &EscalationError{Name: c.name, Restarts: len(restarts), Window: s.window, Err: err}
+				s.logger.Error("supervisor: restart budget exhausted", "name", c.name, "restarts", len(restarts), "window", s.window, "err", err)
+				if eerr := s.escalate(ctx, ee); eerr != nil {
+					return eerr
+				}
+				restarts = restarts[:0]
+			}
+			restarts = append(restarts, now)
+		}
+
+		delay := s.backoff.Backoff(attempt)
+		s.logger.Warn("supervisor: restarting runner", "name", c.name, "err", err, "attempt", attempt, "backoff", delay)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// run calls r.Run, converting a panic into an error.
+func run(ctx context.Context, r Runner) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return r.Run(ctx)
+}
+
+// prune drops the times before cutoff from ts, which is in ascending order.
+func prune(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
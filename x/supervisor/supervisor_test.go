@@ -0,0 +1,211 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	batch "github.com/runreveal/kawa/x/batcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	quiet     = Logger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fast      = Backoff(kawa.RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	errFlaky  = errors.New("flaky")
+	errBroken = errors.New("broken")
+)
+
+func TestSupervisorRestarts(t *testing.T) {
+	var runs atomic.Int32
+	healthy := make(chan struct{})
+	flaky := RunFunc(func(ctx context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			return errFlaky
+		case 2:
+			panic("oops")
+		}
+		close(healthy)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s := New(fast, quiet)
+	s.Add("flaky", flaky)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case <-healthy:
+	case <-time.After(time.Second):
+		t.Fatal("runner wasn't restarted")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(3), runs.Load())
+}
+
+func TestSupervisorEscalation(t *testing.T) {
+	var runs, otherStopped atomic.Int32
+	broken := RunFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		return errBroken
+	})
+	other := RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		otherStopped.Add(1)
+		return nil
+	})
+
+	s := New(fast, quiet, Budget(3, time.Minute))
+	s.Add("broken", broken)
+	s.Add("other", other)
+	err := s.Run(context.Background())
+
+	var ee *EscalationError
+	require.ErrorAs(t, err, &ee)
+	assert.Equal(t, "broken", ee.Name)
+	assert.Equal(t, 3, ee.Restarts)
+	assert.ErrorIs(t, err, errBroken)
+	assert.Equal(t, int32(4), runs.Load(), "initial run plus 3 restarts")
+	assert.Equal(t, int32(1), otherStopped.Load(), "other runners should be stopped")
+}
+
+func TestSupervisorEscalateContinue(t *testing.T) {
+	var runs, escalations atomic.Int32
+	broken := RunFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		return errBroken
+	})
+	s := New(fast, quiet, Budget(2, time.Minute), Escalate(func(ctx context.Context, err *EscalationError) error {
+		if escalations.Add(1) == 3 {
+			return errors.New("giving up")
+		}
+		return nil
+	}))
+	s.Add("broken", broken)
+
+	err := s.Run(context.Background())
+	assert.EqualError(t, err, "giving up")
+	assert.Equal(t, int32(3), escalations.Load())
+	assert.Equal(t, int32(7), runs.Load(), "budget should be reset after each escalation")
+}
+
+func TestSupervisorExit(t *testing.T) {
+	var runs atomic.Int32
+	s := New(fast, quiet)
+	s.Add("once", RunFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}))
+	assert.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, int32(1), runs.Load(), "runners returning nil aren't restarted")
+
+	// Run may be called again once it has returned.
+	assert.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, int32(2), runs.Load())
+}
+
+func TestSupervisorRestartsProcessor(t *testing.T) {
+	msgs := make(chan string, 2)
+	acked := make(chan string, 2)
+	src := kawa.SourceFunc[string](func(ctx context.Context) (kawa.Message[string], func(), error) {
+		select {
+		case v := <-msgs:
+			return kawa.Message[string]{Value: v}, func() { acked <- v }, nil
+		case <-ctx.Done():
+			return kawa.Message[string]{}, nil, ctx.Err()
+		}
+	})
+	var sends atomic.Int32
+	dst := kawa.DestinationFunc[string](func(ctx context.Context, ack func(), msgs ...kawa.Message[string]) error {
+		if sends.Add(1) == 1 {
+			return errFlaky
+		}
+		kawa.Ack(ack)
+		return nil
+	})
+	p, err := kawa.New(kawa.Config[string, string]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Pipe[string](),
+	}, kawa.Drain(time.Second))
+	require.NoError(t, err)
+
+	var runs atomic.Int32
+	stopped := make(chan error, 1)
+	s := New(fast, quiet)
+	s.Add("processor", RunFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		err := p.Run(ctx)
+		if ctx.Err() != nil {
+			stopped <- err
+		}
+		return err
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	// The first message fails the processor, and is left for the source to
+	// redeliver.  The restarted processor handles the second.
+	msgs <- "lost"
+	msgs <- "a"
+	select {
+	case v := <-acked:
+		assert.Equal(t, "a", v)
+	case <-time.After(time.Second):
+		t.Fatal("processor wasn't restarted")
+	}
+	assert.Equal(t, int32(2), runs.Load())
+	assert.Zero(t, p.Stats().InFlight, "messages abandoned by the failed run aren't in flight")
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-stopped, "draining shouldn't wait for abandoned messages")
+}
+
+func TestSupervisorRestartsBatcher(t *testing.T) {
+	var flushes atomic.Int32
+	flushed := make(chan string, 2)
+	d := batch.NewDestination[string](batch.FlushFunc[string](func(ctx context.Context, msgs []kawa.Message[string]) error {
+		if flushes.Add(1) == 1 {
+			return errFlaky
+		}
+		for _, m := range msgs {
+			flushed <- m.Value
+		}
+		return nil
+	}), batch.Raise[string](), batch.FlushLength(1), batch.FlushFrequency(time.Millisecond))
+
+	s := New(fast, quiet)
+	s.Add("batcher", d)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	acked := make(chan string, 2)
+	for _, v := range []string{"lost", "a"} {
+		v := v
+		require.NoError(t, d.Send(ctx, func() { acked <- v }, kawa.Message[string]{Value: v}))
+	}
+	select {
+	case v := <-acked:
+		assert.Equal(t, "a", v)
+	case <-time.After(time.Second):
+		t.Fatal("batcher wasn't restarted")
+	}
+	assert.Equal(t, "a", <-flushed)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, acked, "the failed flush shouldn't be acked")
+}
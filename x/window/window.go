@@ -0,0 +1,286 @@
+// Package window provides event-time windowed aggregation handlers.
+//
+// Messages are assigned to windows by their event time and aggregated per key.
+// A window's result is emitted once the watermark, the latest event time seen
+// minus the allowed lateness, passes the end of the window.  Messages which
+// only belong to windows which have already been emitted are late, and are
+// dropped.
+//
+// Acknowledgement of the aggregated messages is deferred until the result of
+// their window has been acknowledged by the destination, so nothing is lost if
+// the processor stops before a window is emitted.  This relies on the handler
+// being run by a kawa.Processor.  Note that windows only close as new messages
+// advance the watermark: if the source goes quiet, the last windows stay open
+// until more messages arrive.
+package window
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/runreveal/kawa"
+)
+
+// Window is the half-open event time interval [Start, End).
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Attributes are set on the messages emitted by an Aggregator, describing the
+// window which was aggregated.
+type Attributes struct {
+	Window Window
+	// Count is the number of messages aggregated in the window.
+	Count int
+}
+
+func (a Attributes) Unwrap() kawa.Attributes {
+	return nil
+}
+
+type Config[T, Out any] struct {
+	// Timestamp returns the event time of a message.  Required.
+	Timestamp func(kawa.Message[T]) time.Time
+	// Key returns the key to aggregate a message by.  Defaults to the
+	// message's Key.
+	Key func(kawa.Message[T]) string
+	// Reduce folds a message into the window's accumulated value, which
+	// starts as the zero value of Out.  Required.
+	Reduce func(acc Out, msg kawa.Message[T]) Out
+	// AllowedLateness is how far behind the latest event time seen a message
+	// may be and still be aggregated into its window.
+	AllowedLateness time.Duration
+}
+
+// Aggregator is a kawa.Handler which aggregates messages into windows and
+// returns the results of windows as they close.  It's safe for concurrent use.
+type Aggregator[T, Out any] struct {
+	cfg Config[T, Out]
+	// assign returns the windows a message with the given event time belongs
+	// to.  It's nil for session windows.
+	assign func(time.Time) []Window
+	gap    time.Duration
+
+	mu       sync.Mutex
+	maxTime  time.Time
+	panes    map[string]map[Window]*pane[T, Out]
+	sessions map[string][]*pane[T, Out]
+}
+
+type pane[T, Out any] struct {
+	window Window
+	acc    Out
+	count  int
+	acks   []func()
+	// msgs buffers the messages of session windows, which are reduced when
+	// the session closes since sessions may be merged.
+	msgs []kawa.Message[T]
+}
+
+func newAggregator[T, Out any](cfg Config[T, Out]) *Aggregator[T, Out] {
+	if cfg.Timestamp == nil {
+		panic("window: Timestamp must not be nil")
+	}
+	if cfg.Reduce == nil {
+		panic("window: Reduce must not be nil")
+	}
+	if cfg.Key == nil {
+		cfg.Key = func(m kawa.Message[T]) string { return m.Key }
+	}
+	return &Aggregator[T, Out]{
+		cfg:      cfg,
+		panes:    make(map[string]map[Window]*pane[T, Out]),
+		sessions: make(map[string][]*pane[T, Out]),
+	}
+}
+
+// Tumbling aggregates messages into fixed-size, non-overlapping windows.
+func Tumbling[T, Out any](size time.Duration, cfg Config[T, Out]) *Aggregator[T, Out] {
+	return Sliding(size, size, cfg)
+}
+
+// Sliding aggregates messages into fixed-size windows which start every slide
+// interval.  Each message belongs to every window overlapping its event time.
+func Sliding[T, Out any](size, slide time.Duration, cfg Config[T, Out]) *Aggregator[T, Out] {
+	if size <= 0 || slide <= 0 {
+		panic("window: size and slide must be positive")
+	}
+	a := newAggregator(cfg)
+	a.assign = func(ts time.Time) []Window {
+		var ws []Window
+		last := ts.Truncate(slide)
+		for start := last; start.Add(size).After(ts); start = start.Add(-slide) {
+			ws = append(ws, Window{Start: start, End: start.Add(size)})
+		}
+		return ws
+	}
+	return a
+}
+
+// Session aggregates messages into per-key sessions, which close once no
+// message for the key has been seen for gap.
+func Session[T, Out any](gap time.Duration, cfg Config[T, Out]) *Aggregator[T, Out] {
+	if gap <= 0 {
+		panic("window: gap must be positive")
+	}
+	a := newAggregator(cfg)
+	a.gap = gap
+	return a
+}
+
+// Handle adds msg to its windows and returns the results of any windows
+// closed by the advance of the watermark.
+func (a *Aggregator[T, Out]) Handle(ctx context.Context, msg kawa.Message[T]) ([]kawa.Message[Out], error) {
+	ts := a.cfg.Timestamp(msg)
+	key := a.cfg.Key(msg)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ts.After(a.maxTime) {
+		a.maxTime = ts
+	}
+	wm := a.watermark()
+
+	if a.assign == nil {
+		a.addSession(ctx, key, ts, msg, wm)
+	} else {
+		a.addWindows(ctx, key, ts, msg, wm)
+	}
+
+	out, acks := a.closeWindows(wm)
+	if len(acks) > 0 {
+		kawa.OnAck(ctx, func() {
+			for _, ack := range acks {
+				kawa.Ack(ack)
+			}
+		})
+	}
+	return out, nil
+}
+
+func (a *Aggregator[T, Out]) watermark() time.Time {
+	return a.maxTime.Add(-a.cfg.AllowedLateness)
+}
+
+func (a *Aggregator[T, Out]) addWindows(ctx context.Context, key string, ts time.Time, msg kawa.Message[T], wm time.Time) {
+	var open []Window
+	for _, w := range a.assign(ts) {
+		if w.End.After(wm) {
+			open = append(open, w)
+		}
+	}
+	if len(open) == 0 {
+		// late, let the processor acknowledge and drop it
+		return
+	}
+
+	ack := kawa.AckAfter(kawa.HoldAck(ctx), len(open))
+	panes, ok := a.panes[key]
+	if !ok {
+		panes = make(map[Window]*pane[T, Out])
+		a.panes[key] = panes
+	}
+	for _, w := range open {
+		p, ok := panes[w]
+		if !ok {
+			p = &pane[T, Out]{window: w}
+			panes[w] = p
+		}
+		p.acc = a.cfg.Reduce(p.acc, msg)
+		p.count++
+		p.acks = append(p.acks, ack)
+	}
+}
+
+func (a *Aggregator[T, Out]) addSession(ctx context.Context, key string, ts time.Time, msg kawa.Message[T], wm time.Time) {
+	w := Window{Start: ts, End: ts.Add(a.gap)}
+	if !w.End.After(wm) {
+		// late, let the processor acknowledge and drop it
+		return
+	}
+
+	merged := &pane[T, Out]{window: w}
+	var rest []*pane[T, Out]
+	for _, s := range a.sessions[key] {
+		if s.window.Start.After(merged.window.End) || merged.window.Start.After(s.window.End) {
+			rest = append(rest, s)
+			continue
+		}
+		if s.window.Start.Before(merged.window.Start) {
+			merged.window.Start = s.window.Start
+		}
+		if s.window.End.After(merged.window.End) {
+			merged.window.End = s.window.End
+		}
+		merged.msgs = append(merged.msgs, s.msgs...)
+		merged.acks = append(merged.acks, s.acks...)
+	}
+	merged.msgs = append(merged.msgs, msg)
+	merged.acks = append(merged.acks, kawa.HoldAck(ctx))
+	a.sessions[key] = append(rest, merged)
+}
+
+// closeWindows removes the windows which end at or before wm, and returns
+// their results along with the acks of the messages aggregated in them.
+func (a *Aggregator[T, Out]) closeWindows(wm time.Time) ([]kawa.Message[Out], []func()) {
+	var closed []kawa.Message[Out]
+	var acks []func()
+	emit := func(key string, p *pane[T, Out]) {
+		if p.msgs != nil {
+			for _, m := range p.msgs {
+				p.acc = a.cfg.Reduce(p.acc, m)
+			}
+			p.count = len(p.msgs)
+		}
+		closed = append(closed, kawa.Message[Out]{
+			Key:        key,
+			Value:      p.acc,
+			Attributes: Attributes{Window: p.window, Count: p.count},
+		})
+		acks = append(acks, p.acks...)
+	}
+
+	for key, panes := range a.panes {
+		for w, p := range panes {
+			if w.End.After(wm) {
+				continue
+			}
+			emit(key, p)
+			delete(panes, w)
+		}
+		if len(panes) == 0 {
+			delete(a.panes, key)
+		}
+	}
+
+	for key, sessions := range a.sessions {
+		var open []*pane[T, Out]
+		for _, s := range sessions {
+			if s.window.End.After(wm) {
+				open = append(open, s)
+				continue
+			}
+			emit(key, s)
+		}
+		if len(open) == 0 {
+			delete(a.sessions, key)
+		} else {
+			a.sessions[key] = open
+		}
+	}
+
+	// emit in a deterministic order
+	sort.SliceStable(closed, func(i, j int) bool {
+		wi := closed[i].Attributes.(Attributes).Window
+		wj := closed[j].Attributes.(Attributes).Window
+		if !wi.End.Equal(wj.End) {
+			return wi.End.Before(wj.End)
+		}
+		return closed[i].Key < closed[j].Key
+	})
+	return closed, acks
+}
@@ -0,0 +1,237 @@
+package window
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runreveal/kawa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	user string
+	at   time.Time
+}
+
+func count(acc int, _ kawa.Message[event]) int { return acc + 1 }
+
+func eventConfig() Config[event, int] {
+	return Config[event, int]{
+		Timestamp: func(m kawa.Message[event]) time.Time { return m.Value.at },
+		Key:       func(m kawa.Message[event]) string { return m.Value.user },
+		Reduce:    count,
+	}
+}
+
+func handleAll(t *testing.T, h kawa.Handler[event, int], evs []event) []kawa.Message[int] {
+	t.Helper()
+	var out []kawa.Message[int]
+	for _, ev := range evs {
+		res, err := h.Handle(context.Background(), kawa.Message[event]{Value: ev})
+		require.NoError(t, err)
+		out = append(out, res...)
+	}
+	return out
+}
+
+func TestTumbling(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+
+	h := Tumbling(10*time.Second, eventConfig())
+	out := handleAll(t, h, []event{
+		{"alice", at(1)},
+		{"bob", at(2)},
+		{"alice", at(5)},
+		{"alice", at(12)}, // closes [0s, 10s)
+		{"bob", at(3)},    // late
+		{"alice", at(25)}, // closes [10s, 20s)
+	})
+
+	require.Len(t, out, 3)
+	assert.Equal(t, "alice", out[0].Key)
+	assert.Equal(t, 2, out[0].Value)
+	assert.Equal(t, "bob", out[1].Key)
+	assert.Equal(t, 1, out[1].Value)
+	assert.Equal(t, "alice", out[2].Key)
+	assert.Equal(t, 1, out[2].Value)
+	attrs := out[2].Attributes.(Attributes)
+	assert.Equal(t, Window{Start: at(10), End: at(20)}, attrs.Window)
+	assert.Equal(t, 1, attrs.Count)
+}
+
+func TestSlidingLateness(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+
+	cfg := eventConfig()
+	cfg.AllowedLateness = 5 * time.Second
+	h := Sliding(10*time.Second, 5*time.Second, cfg)
+	out := handleAll(t, h, []event{
+		{"alice", at(7)},  // [0s, 10s) and [5s, 15s)
+		{"alice", at(13)}, // [5s, 15s) and [10s, 20s)
+		{"alice", at(3)},  // within lateness for [0s, 10s) only
+		{"alice", at(16)}, // closes [0s, 10s)
+	})
+
+	require.Len(t, out, 1)
+	assert.Equal(t, Window{Start: at(0), End: at(10)}, out[0].Attributes.(Attributes).Window)
+	assert.Equal(t, 2, out[0].Value)
+}
+
+func TestSession(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+
+	cfg := eventConfig()
+	cfg.AllowedLateness = 10 * time.Second
+	h := Session(5*time.Second, cfg)
+	out := handleAll(t, h, []event{
+		{"alice", at(0)},
+		{"alice", at(8)},
+		{"alice", at(4)}, // merges the sessions at 0s and 8s
+		{"bob", at(30)},  // closes alice's session
+	})
+
+	require.Len(t, out, 1)
+	assert.Equal(t, "alice", out[0].Key)
+	assert.Equal(t, 3, out[0].Value)
+	assert.Equal(t, Window{Start: at(0), End: at(13)}, out[0].Attributes.(Attributes).Window)
+}
+
+func TestDeferredAcks(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	evs := []event{
+		{"alice", at(1)},
+		{"alice", at(2)},
+		{"alice", at(11)},
+	}
+
+	acked := make(chan int, len(evs))
+	var i int
+	src := kawa.SourceFunc[event](func(ctx context.Context) (kawa.Message[event], func(), error) {
+		if i == len(evs) {
+			<-ctx.Done()
+			return kawa.Message[event]{}, nil, ctx.Err()
+		}
+		n := i
+		i++
+		return kawa.Message[event]{Value: evs[n]}, func() { acked <- n }, nil
+	})
+
+	sent := make(chan func(), 1)
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		sent <- ack
+		return nil
+	})
+
+	p, err := kawa.New(kawa.Config[event, int]{
+		Source:      src,
+		Destination: dst,
+		Handler:     Tumbling(10*time.Second, eventConfig()),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	var ack func()
+	select {
+	case ack = <-sent:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for window output")
+	}
+	// The messages in the first window must not be acked before its output.
+	select {
+	case n := <-acked:
+		t.Fatalf("message %d acked before window output", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	kawa.Ack(ack)
+	got := []int{<-acked, <-acked}
+	assert.ElementsMatch(t, []int{0, 1}, got)
+	assert.Empty(t, acked, "message in the open window should not be acked")
+
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestDeferredAcksFanOut(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	// The first message holds events in two windows, and is acknowledged only
+	// once both windows' outputs have been.
+	batches := [][]event{
+		{{"alice", at(1)}, {"alice", at(11)}},
+		{{"alice", at(25)}},
+	}
+
+	acked := make(chan int, len(batches))
+	next := make(chan int, len(batches))
+	next <- 0
+	src := kawa.SourceFunc[[]event](func(ctx context.Context) (kawa.Message[[]event], func(), error) {
+		select {
+		case n := <-next:
+			return kawa.Message[[]event]{Value: batches[n]}, func() { acked <- n }, nil
+		case <-ctx.Done():
+			return kawa.Message[[]event]{}, nil, ctx.Err()
+		}
+	})
+
+	sent := make(chan func(), 1)
+	dst := kawa.DestinationFunc[int](func(ctx context.Context, ack func(), msgs ...kawa.Message[int]) error {
+		sent <- ack
+		return nil
+	})
+
+	split := kawa.FlatMap(func(evs []event) ([]event, error) { return evs, nil })
+	p, err := kawa.New(kawa.Config[[]event, int]{
+		Source:      src,
+		Destination: dst,
+		Handler:     kawa.Compose(split, kawa.Handler[event, int](Tumbling(10*time.Second, eventConfig()))),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- p.Run(ctx) }()
+
+	output := func() func() {
+		select {
+		case ack := <-sent:
+			return ack
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for window output")
+			return nil
+		}
+	}
+
+	// The first window closes, but the message's event in the second window
+	// still holds it back.
+	kawa.Ack(output())
+	select {
+	case n := <-acked:
+		t.Fatalf("message %d acked while one of its windows is open", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	next <- 1
+	kawa.Ack(output())
+	select {
+	case n := <-acked:
+		assert.Equal(t, 0, n)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for ack")
+	}
+	assert.Empty(t, acked, "message in the open window should not be acked")
+
+	cancel()
+	assert.NoError(t, <-errc)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package windows
+
+import "github.com/runreveal/kawa"
+
+// Attributes are set on messages received by the EventLogSource.  Use
+// kawa.AttributesAs to retrieve them.
+type Attributes struct {
+	// RecordID is the event's EventRecordID.
+	RecordID uint64
+	Channel  string
+}
+
+func (a Attributes) Unwrap() kawa.Attributes {
+	return nil
+}
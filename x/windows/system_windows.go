@@ -6,6 +6,7 @@ package windows
 import (
 	"encoding/xml"
 	"fmt"
+	"strconv"
 	"syscall"
 	"unsafe"
 
@@ -153,10 +154,15 @@ func (evtSub *eventSubscription) winAPICallback(action, userContext, event uintp
 			} else {
 				// take dataParsed and convert back to json object for sending to server
 				jsonEvt := xEvt.ToJSONEvent()
+				recordID, _ := strconv.ParseUint(jsonEvt.System.EventRecordID, 10, 64)
 				msg := msgAck{
 					msg: kawa.Message[EventLog]{
 						Value: *jsonEvt,
 						Topic: evtSub.Channel,
+						Attributes: Attributes{
+							RecordID: recordID,
+							Channel:  jsonEvt.System.Channel,
+						},
 					},
 					ack: nil,
 				}